@@ -0,0 +1,38 @@
+package broker
+
+import (
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// the consumption paths of filtered messages
+const (
+	WebhookConsumer = "webhook"
+	SSEConsumer     = "sse"
+	PollConsumer    = "poll"
+)
+
+// filteredMessages counts the messages acknowledged without delivery since they do not match the filter
+var filteredMessages = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "pulsar_beam_filtered_messages_total",
+		Help: "The number of messages acknowledged without delivery since they do not match the filter.",
+	},
+	[]string{"consumer"},
+)
+
+func init() {
+	prometheus.MustRegister(filteredMessages)
+}
+
+// Filtered returns true if the message does not match the filter, and counts it on the consumption path.
+// The caller acknowledges a filtered message without delivery. The payload is the decoded payload, which is
+// only required if the filter refers to the payload.
+func Filtered(filter *model.Filter, consumer string, msg pulsar.Message, payload []byte) bool {
+	if filter.Match(msg.Key(), msg.Properties(), payload) {
+		return false
+	}
+	filteredMessages.WithLabelValues(consumer).Inc()
+	return true
+}
@@ -0,0 +1,53 @@
+package broker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+// mockMessage is a Pulsar message with the fields used by the webhook delivery
+type mockMessage struct {
+	pulsar.Message
+	key             string
+	payload         []byte
+	properties      map[string]string
+	redeliveryCount uint32
+}
+
+func (m *mockMessage) Topic() string                 { return "persistent://ten/ns/topic" }
+func (m *mockMessage) Key() string                   { return m.key }
+func (m *mockMessage) OrderingKey() string           { return "" }
+func (m *mockMessage) Payload() []byte               { return m.payload }
+func (m *mockMessage) Properties() map[string]string { return m.properties }
+func (m *mockMessage) ID() pulsar.MessageID          { return pulsar.EarliestMessageID() }
+func (m *mockMessage) PublishTime() time.Time        { return time.Unix(1600000000, 0) }
+func (m *mockMessage) EventTime() time.Time          { return time.Time{} }
+func (m *mockMessage) RedeliveryCount() uint32       { return m.redeliveryCount }
+
+// mockConsumer records the acknowledged and negatively acknowledged messages
+type mockConsumer struct {
+	pulsar.Consumer
+	acked  []pulsar.Message
+	nacked []pulsar.Message
+	sync.Mutex
+}
+
+func (c *mockConsumer) Ack(msg pulsar.Message) {
+	c.Lock()
+	defer c.Unlock()
+	c.acked = append(c.acked, msg)
+}
+
+func (c *mockConsumer) Nack(msg pulsar.Message) {
+	c.Lock()
+	defer c.Unlock()
+	c.nacked = append(c.nacked, msg)
+}
+
+func (c *mockConsumer) settled() (acked, nacked []pulsar.Message) {
+	c.Lock()
+	defer c.Unlock()
+	return append([]pulsar.Message{}, c.acked...), append([]pulsar.Message{}, c.nacked...)
+}
@@ -0,0 +1,204 @@
+package broker
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/kafkaesque-io/pulsar-beam/src/pulsardriver"
+	"github.com/kafkaesque-io/pulsar-beam/src/util"
+	log "github.com/sirupsen/logrus"
+)
+
+var pollConsumerTTL = util.GetEnvInt("PollConsumerCacheTTL", 300)
+
+// the receiver queue size of a poll consumer bounds the messages prefetched and pinned to this process
+var pollReceiverQueueSize = util.GetEnvInt("PollReceiverQueueSize", 100)
+
+// a message whose visibility timeout expires or is negatively acknowledged is redelivered after the delay
+const pollNackRedeliveryDelay = time.Second
+
+// pollConsumers caches the consumers of durable poll subscriptions, keyed by the consumer key in pulsardriver.ConsumerCache.
+// A consumer idle for the TTL is closed, and the messages not acknowledged by the client are redelivered by Pulsar.
+var pollConsumers = util.NewCache(util.CacheOption{
+	TTL:           time.Duration(pollConsumerTTL) * time.Second,
+	CleanInterval: time.Duration(pollConsumerTTL+2) * time.Second,
+	ExpireCallback: func(key string, value interface{}) {
+		if pc, ok := value.(*pollConsumer); ok {
+			pc.release()
+		}
+		pulsardriver.ClosePulsarConsumer(key)
+	},
+})
+
+// pollConsumerLock serializes the creation and eviction of poll consumers so that a subscription is only subscribed once
+var pollConsumerLock sync.Mutex
+
+// pollConsumer is a cached consumer of a durable poll subscription
+type pollConsumer struct {
+	key      string
+	token    string
+	consumer pulsar.Consumer
+	// an exclusive or failover consumer is closed as soon as it is idle so that it does not hold the subscription
+	exclusive bool
+	// the number of polls in progress
+	inFlight int
+	// the messages polled and waiting for the client acknowledgement, keyed by the receipt handle
+	// A receipt handle only exists in the process that polled the message, so only that process can settle it.
+	pending map[string]*pendingMessage
+	sync.Mutex
+}
+
+// pendingMessage is a polled message invisible to the subscription until its visibility timeout expires
+type pendingMessage struct {
+	msg        pulsar.Message
+	visibility *time.Timer
+}
+
+// pollConsumerKey returns the key of a poll subscription consumer
+// The key does not include the token, so that a rotated token replaces the consumer rather than competing with it.
+func pollConsumerKey(url, topic, subscriptionName string) string {
+	return "poll" + url + topic + subscriptionName
+}
+
+// getPollConsumer gets the cached consumer of a durable subscription, or subscribes a new one from the earliest position.
+// The poll must call done once it finishes.
+func getPollConsumer(url, token, topic, subscriptionName string, subType pulsar.SubscriptionType) (*pollConsumer, error) {
+	key := pollConsumerKey(url, topic, subscriptionName)
+	pollConsumerLock.Lock()
+	defer pollConsumerLock.Unlock()
+	pc, ok := lookupPollConsumer(key, token)
+	if !ok {
+		consumer, err := pulsardriver.GetSubscriptionConsumer(url, token, topic, subscriptionName, pulsar.SubscriptionPositionEarliest, subType, pollNackRedeliveryDelay, pollReceiverQueueSize, key)
+		if err != nil {
+			return nil, err
+		}
+		pc = &pollConsumer{
+			key:       key,
+			token:     token,
+			consumer:  consumer,
+			exclusive: subType == pulsar.Exclusive || subType == pulsar.Failover,
+			pending:   make(map[string]*pendingMessage),
+		}
+		pollConsumers.Set(key, pc)
+	}
+	pc.Lock()
+	pc.inFlight++
+	pc.Unlock()
+	return pc, nil
+}
+
+// lookupPollConsumer returns the cached consumer created with the same token
+// A consumer created with another token is closed, and the messages held by it are redelivered.
+func lookupPollConsumer(key, token string) (*pollConsumer, bool) {
+	obj, ok := pollConsumers.Get(key)
+	if !ok {
+		return nil, false
+	}
+	if pc, ok := obj.(*pollConsumer); ok && pc.token == token {
+		return pc, true
+	}
+	pollConsumers.Delete(key)
+	return nil, false
+}
+
+// done ends a poll on the consumer
+func (pc *pollConsumer) done() {
+	pc.Lock()
+	pc.inFlight--
+	pc.Unlock()
+	pc.closeIfIdle()
+}
+
+// closeIfIdle closes an exclusive or failover consumer that has no poll in progress and holds no message
+func (pc *pollConsumer) closeIfIdle() {
+	if !pc.exclusive {
+		return
+	}
+	pollConsumerLock.Lock()
+	defer pollConsumerLock.Unlock()
+	pc.Lock()
+	idle := pc.inFlight == 0 && len(pc.pending) == 0
+	pc.Unlock()
+	if obj, ok := pollConsumers.Get(pc.key); idle && ok && obj == pc {
+		pollConsumers.Delete(pc.key)
+	}
+}
+
+// hold keeps a polled message unacknowledged until the client acknowledges it by the returned receipt handle,
+// or the message is redelivered once the visibility timeout expires.
+func (pc *pollConsumer) hold(msg pulsar.Message, visibilityTimeout time.Duration) string {
+	handle, err := util.NewUUID()
+	if err != nil {
+		// the message is redelivered rather than held without a receipt handle
+		log.Errorf("failed to generate receipt handle error %v", err)
+		pc.consumer.Nack(msg)
+		return ""
+	}
+	pc.Lock()
+	defer pc.Unlock()
+	pc.pending[handle] = &pendingMessage{
+		msg: msg,
+		visibility: time.AfterFunc(visibilityTimeout, func() {
+			pc.settle([]string{handle}, false)
+			pc.closeIfIdle()
+		}),
+	}
+	return handle
+}
+
+// settle acknowledges, or negatively acknowledges for redelivery, the pending messages of the receipt handles.
+// It returns the receipt handles settled and the unknown ones, which may have expired and been redelivered.
+func (pc *pollConsumer) settle(handles []string, ack bool) (succeeded, failed []string) {
+	pc.Lock()
+	defer pc.Unlock()
+	succeeded, failed = []string{}, []string{}
+	for _, handle := range handles {
+		p, ok := pc.pending[handle]
+		if !ok {
+			failed = append(failed, handle)
+			continue
+		}
+		p.visibility.Stop()
+		delete(pc.pending, handle)
+		if ack {
+			pc.consumer.Ack(p.msg)
+		} else {
+			pc.consumer.Nack(p.msg)
+		}
+		succeeded = append(succeeded, handle)
+	}
+	return succeeded, failed
+}
+
+// release stops the visibility timers and forgets the pending messages before the consumer is closed or sought,
+// since Pulsar redelivers them
+func (pc *pollConsumer) release() {
+	pc.Lock()
+	defer pc.Unlock()
+	for handle, p := range pc.pending {
+		p.visibility.Stop()
+		delete(pc.pending, handle)
+	}
+}
+
+// AckPolledMessages acknowledges, or negatively acknowledges for redelivery if ack is false,
+// the messages polled from a durable subscription by their receipt handles.
+func AckPolledMessages(url, token, topic, subscriptionName string, handles []string, ack bool) model.AckResponse {
+	pollConsumerLock.Lock()
+	pc, ok := lookupPollConsumer(pollConsumerKey(url, topic, subscriptionName), token)
+	pollConsumerLock.Unlock()
+	if !ok {
+		return model.AckResponse{Succeeded: []string{}, Failed: handles}
+	}
+	succeeded, failed := pc.settle(handles, ack)
+	pc.closeIfIdle()
+	return model.AckResponse{Succeeded: succeeded, Failed: failed}
+}
+
+// isDurable returns true if the subscription is kept across polls
+func isDurable(subscriptionName string) bool {
+	return !strings.HasPrefix(subscriptionName, model.NonResumable)
+}
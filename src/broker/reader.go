@@ -0,0 +1,65 @@
+package broker
+
+import (
+	"context"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+)
+
+// ReadOptions are the options of reading a page of messages
+type ReadOptions struct {
+	// the message id to start reading from, the earliest message if it is nil
+	StartID pulsar.MessageID
+	// Inclusive reads the message of the start id, otherwise reading starts after it as a continuation cursor
+	Inclusive bool
+	// StartTime reads from the first message published at or after the time, the start id is ignored if it is set
+	StartTime *time.Time
+	// the max number of messages in a page
+	Size int
+	// the time to wait for the next message, the page is returned once it times out
+	PerMessageTimeout time.Duration
+}
+
+// ReadMessages reads a page of messages by a reader without creating a subscription,
+// the payload is decoded to JSON if the topic has a schema.
+// The page ends at the size, the end of the topic, or the per message timeout.
+func ReadMessages(ctx context.Context, url, token, topic string, opts ReadOptions, schema *model.TopicSchema) (model.PulsarMessages, error) {
+	messages := model.NewPulsarMessages(opts.Size)
+	startID := opts.StartID
+	if startID == nil || opts.StartTime != nil {
+		startID = pulsar.EarliestMessageID()
+	}
+	client, reader, err := GetPulsarClientReader(url, token, topic, startID, opts.Inclusive)
+	if err != nil {
+		return messages, err
+	}
+	defer client.Close()
+	defer reader.Close()
+
+	if opts.StartTime != nil {
+		if err = reader.SeekByTime(*opts.StartTime); err != nil {
+			return messages, err
+		}
+	}
+
+	for reader.HasNext() {
+		nextCtx, cancel := context.WithTimeout(ctx, opts.PerMessageTimeout)
+		msg, err := reader.Next(nextCtx)
+		cancel()
+		if err != nil {
+			// the page is returned once the next message times out or the client goes away
+			if ctx.Err() != nil || nextCtx.Err() != nil {
+				break
+			}
+			return messages, err
+		}
+		full := messages.AddPulsarMessage(msg, DecodePayload(schema, msg))
+		messages.Cursor = model.MessageIDString(msg.ID())
+		if full {
+			break
+		}
+	}
+	return messages, nil
+}
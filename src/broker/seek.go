@@ -0,0 +1,79 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/kafkaesque-io/pulsar-beam/src/pulsardriver"
+)
+
+// ErrSubscriptionBusy is returned when an exclusive subscription to be sought is held by a consumer
+// in another process, such as a webhook broker running separately from the REST API
+var ErrSubscriptionBusy = errors.New("the exclusive subscription is consumed by another process and can only be sought by the process consuming it")
+
+// SeekWebhook resets the subscription of a webhook
+// The consumer of a webhook running by the webhook broker in the same process is cached by its subscription key,
+// so that the webhook keeps consuming from the new position.
+func SeekWebhook(cfg *model.TopicConfig, whCfg model.WebhookConfig, req model.SeekRequest) error {
+	subType, err := model.GetSubscriptionType(whCfg.SubscriptionType)
+	if err != nil {
+		return err
+	}
+	return seekSubscription(SubscriptionKey(cfg.Key, whCfg), cfg.PulsarURL, cfg.Token, cfg.TopicFullName, whCfg.Subscription, subType, req)
+}
+
+// SeekPollSubscription resets a durable poll subscription
+// The receipt handles of the messages polled earlier from the cached consumer are no longer valid.
+func SeekPollSubscription(url, token, topic, subscriptionName string, subType pulsar.SubscriptionType, req model.SeekRequest) error {
+	key := pollConsumerKey(url, topic, subscriptionName)
+	pollConsumerLock.Lock()
+	if pc, ok := lookupPollConsumer(key, token); ok {
+		pc.release()
+	}
+	pollConsumerLock.Unlock()
+	return seekSubscription(key, url, token, topic, subscriptionName, subType, req)
+}
+
+// seekSubscription seeks the consumer cached by the key, or a consumer created for the seek if the subscription
+// is not consumed in this process. The latter fails with ErrSubscriptionBusy if a consumer in another process
+// holds an exclusive subscription.
+func seekSubscription(key, url, token, topic, subscriptionName string, subType pulsar.SubscriptionType, req model.SeekRequest) error {
+	if c, ok := pulsardriver.GetCachedConsumer(key); ok {
+		return seek(c, req)
+	}
+
+	client, consumer, err := GetPulsarClientConsumer(url, token, topic, subscriptionName, subType, pulsar.SubscriptionPositionLatest)
+	if err != nil {
+		// the client does not type the broker errors, which are in the format of "server error: ConsumerBusy: ..."
+		if strings.Contains(err.Error(), "ConsumerBusy") {
+			return fmt.Errorf("%w: %s", ErrSubscriptionBusy, subscriptionName)
+		}
+		return fmt.Errorf("failed to subscribe %s to seek error %v", subscriptionName, err)
+	}
+	defer client.Close()
+	defer consumer.Close()
+	return seek(consumer, req)
+}
+
+// seek resets the subscription of the consumer to the seek request target
+// The earliest and latest positions are sought by time since the client ignores the earliest and latest message ids.
+func seek(c pulsar.Consumer, req model.SeekRequest) error {
+	switch {
+	case req.MessageID != "":
+		id, err := model.ParseMessageID(req.MessageID)
+		if err != nil {
+			return err
+		}
+		return c.Seek(id)
+	case req.Timestamp != nil:
+		return c.SeekByTime(*req.Timestamp)
+	case req.Position == model.SeekEarliest:
+		return c.SeekByTime(time.Unix(0, 0))
+	default:
+		return c.SeekByTime(time.Now())
+	}
+}
@@ -1,7 +1,7 @@
 package broker
 
 import (
-	"strings"
+	"context"
 	"time"
 
 	"github.com/apache/pulsar-client-go/pulsar"
@@ -30,32 +30,153 @@ func GetPulsarClientConsumer(url, token, topic, subscriptionName string, subType
 	return client, consumer, nil
 }
 
-// PollBatchMessages polls a batch of consumer messages
-func PollBatchMessages(url, token, topic, subscriptionName string, subType pulsar.SubscriptionType, size, perMessageTimeoutMs int) (model.PulsarMessages, error) {
+// GetPulsarClientReader returns Pulsar client and reader interface objects that read messages after the start message id,
+// or from the start message id if it is inclusive
+func GetPulsarClientReader(url, token, topic string, startID pulsar.MessageID, inclusive bool) (pulsar.Client, pulsar.Reader, error) {
+	client, err := pulsardriver.NewPulsarClient(url, token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := client.CreateReader(pulsar.ReaderOptions{
+		Topic:                   topic,
+		StartMessageID:          startID,
+		StartMessageIDInclusive: inclusive,
+	})
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+
+	return client, reader, nil
+}
+
+// PollOptions are the options of polling a batch of messages
+type PollOptions struct {
+	// the max number of messages in a batch
+	Size int
+	// the time to wait for the next message, the batch is returned once it times out
+	PerMessageTimeout time.Duration
+	// the time to wait for the first message in long poll, the batch is returned as soon as the first message
+	// arrives with the messages already received by the consumer
+	Wait time.Duration
+	// AutoAck acknowledges the messages as they are polled, otherwise every message is returned with a receipt handle
+	// and kept unacknowledged until the client acknowledges it or the visibility timeout expires
+	AutoAck           bool
+	VisibilityTimeout time.Duration
+	// the receipt handles of the messages polled earlier to be acknowledged before this poll
+	Acks []string
+	// the messages not matching the filter are acknowledged without being returned
+	Filter *model.Filter
+}
+
+// PollBatchMessages polls a batch of consumer messages, the payload is decoded to JSON if the topic has a schema
+// A non-resumable subscription is created and unsubscribed per poll, and its messages are always acknowledged.
+// The consumer of a durable subscription is cached across polls, except that an exclusive or failover consumer
+// is closed once no poll is in progress and no message is held for acknowledgement.
+func PollBatchMessages(ctx context.Context, url, token, topic, subscriptionName string, subType pulsar.SubscriptionType, opts PollOptions, schema *model.TopicSchema) (model.PulsarMessages, error) {
 	log.Infof("getbatchmessages called")
+	if isDurable(subscriptionName) {
+		pc, err := getPollConsumer(url, token, topic, subscriptionName, subType)
+		if err != nil {
+			return model.NewPulsarMessages(opts.Size), err
+		}
+		defer pc.done()
+		pc.settle(opts.Acks, true)
+		if opts.AutoAck {
+			return receiveBatch(ctx, pc.consumer, opts, schema, ackMessage(pc.consumer)), nil
+		}
+		return receiveBatch(ctx, pc.consumer, opts, schema, func(msg pulsar.Message) string {
+			return pc.hold(msg, opts.VisibilityTimeout)
+		}), nil
+	}
+
 	client, consumer, err := GetPulsarClientConsumer(url, token, topic, subscriptionName, subType, pulsar.SubscriptionPositionEarliest)
 	if err != nil {
-		return model.NewPulsarMessages(size), err
-	}
-	if strings.HasPrefix(subscriptionName, model.NonResumable) {
-		defer consumer.Unsubscribe()
+		return model.NewPulsarMessages(opts.Size), err
 	}
+	defer consumer.Unsubscribe()
 	defer consumer.Close()
 	defer client.Close()
 
-	messages := model.NewPulsarMessages(size)
+	return receiveBatch(ctx, consumer, opts, schema, ackMessage(consumer)), nil
+}
+
+// ackMessage returns a deliver function that acknowledges a message as it is polled
+func ackMessage(consumer pulsar.Consumer) func(pulsar.Message) string {
+	return func(msg pulsar.Message) string {
+		consumer.Ack(msg)
+		return ""
+	}
+}
+
+// receiveBatch receives a batch of messages and passes every message to the deliver function,
+// which returns the receipt handle of the message if it is not acknowledged
+func receiveBatch(ctx context.Context, consumer pulsar.Consumer, opts PollOptions, schema *model.TopicSchema, deliver func(pulsar.Message) string) model.PulsarMessages {
+	messages := model.NewPulsarMessages(opts.Size)
 	consumChan := consumer.Chan()
-	for i := 0; i < size; i++ {
-		select {
-		case msg := <-consumChan:
-			// log.Infof("received message %s on topic %s", string(msg.Payload()), msg.Topic())
-			messages.AddPulsarMessage(msg)
+	add := func(msg pulsar.Message) bool {
+		payload := DecodePayload(schema, msg)
+		if Filtered(opts.Filter, PollConsumer, msg, payload) {
 			consumer.Ack(msg)
+			return false
+		}
+		m := model.NewPulsarMessage(msg, payload)
+		m.ReceiptHandle = deliver(msg)
+		return messages.Add(m)
+	}
 
-		case <-time.After(time.Duration(perMessageTimeoutMs) * time.Millisecond): //TODO: this should be configurable
-			i = size
+	if opts.Wait > 0 {
+		timer := time.NewTimer(opts.Wait)
+		defer timer.Stop()
+		// a filtered message does not end the wait for the first message
+		for messages.IsEmpty() {
+			select {
+			case cm := <-consumChan:
+				if add(cm.Message) {
+					return messages
+				}
+			case <-timer.C:
+				return messages
+			case <-ctx.Done():
+				return messages
+			}
+		}
+		// only the messages already received are added to the batch
+		for {
+			select {
+			case cm := <-consumChan:
+				if add(cm.Message) {
+					return messages
+				}
+			default:
+				return messages
+			}
+		}
+	}
+
+	for {
+		select {
+		case cm := <-consumChan:
+			if add(cm.Message) {
+				return messages
+			}
+		case <-time.After(opts.PerMessageTimeout):
+			return messages
+		case <-ctx.Done():
+			return messages
 		}
 	}
+}
 
-	return messages, nil
+// DecodePayload decodes the message payload with the topic schema.
+// The raw payload is returned if the topic has no schema or the payload cannot be decoded,
+// such as a message published before the schema is set.
+func DecodePayload(schema *model.TopicSchema, msg pulsar.Message) []byte {
+	data, err := schema.Decode(msg.Payload())
+	if err != nil {
+		log.Warnf("failed to decode message %v on topic %s with schema error %v", msg.ID(), msg.Topic(), err)
+		return msg.Payload()
+	}
+	return data
 }
@@ -0,0 +1,99 @@
+package broker
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// webhookAuthorizer builds the Authorization header value of the requests to a webhook
+type webhookAuthorizer interface {
+	authorization() (string, error)
+	// invalidate discards a cached credential after the webhook rejects it with 401
+	invalidate()
+}
+
+// defaultTokenTimeout is the OAuth2 token request timeout of a webhook without a request timeout
+const defaultTokenTimeout = 10 * time.Second
+
+// newWebhookAuthorizer creates the authorizer of a webhook, nil if the webhook has no auth
+func newWebhookAuthorizer(whCfg model.WebhookConfig) (webhookAuthorizer, error) {
+	auth, err := model.GetWebhookAuth(whCfg)
+	if err != nil || auth == nil {
+		return nil, err
+	}
+	switch auth.Type {
+	case model.BasicAuth:
+		credential := base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+		return staticAuthorizer("Basic " + credential), nil
+	case model.BearerAuth:
+		return staticAuthorizer("Bearer " + auth.Token), nil
+	default:
+		_, _, timeout, err := model.GetRetryPolicy(whCfg).Durations()
+		if err != nil {
+			return nil, err
+		}
+		if timeout == 0 {
+			timeout = defaultTokenTimeout
+		}
+		return newOAuth2Authorizer(auth, timeout), nil
+	}
+}
+
+// staticAuthorizer is a basic or bearer authorization
+type staticAuthorizer string
+
+func (a staticAuthorizer) authorization() (string, error) {
+	return string(a), nil
+}
+
+func (a staticAuthorizer) invalidate() {}
+
+// oauth2Authorizer gets an access token with the OAuth2 client credentials grant
+// The token is cached and shared by the delivery workers of the webhook until it is about to expire.
+// A token request times out in the same way as a webhook request, or after defaultTokenTimeout.
+type oauth2Authorizer struct {
+	config *clientcredentials.Config
+	client *http.Client
+	lock   sync.Mutex
+	source oauth2.TokenSource
+}
+
+func newOAuth2Authorizer(auth *model.WebhookAuth, timeout time.Duration) *oauth2Authorizer {
+	a := &oauth2Authorizer{
+		client: &http.Client{Timeout: timeout},
+		config: &clientcredentials.Config{
+			ClientID:     auth.ClientID,
+			ClientSecret: auth.ClientSecret,
+			TokenURL:     auth.TokenURL,
+			Scopes:       auth.Scopes,
+		},
+	}
+	a.invalidate()
+	return a
+}
+
+func (a *oauth2Authorizer) authorization() (string, error) {
+	a.lock.Lock()
+	source := a.source
+	a.lock.Unlock()
+
+	token, err := source.Token()
+	if err != nil {
+		return "", err
+	}
+	return token.Type() + " " + token.AccessToken, nil
+}
+
+// invalidate replaces the token source so that the next request fetches a new token
+func (a *oauth2Authorizer) invalidate() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.source = a.config.TokenSource(context.WithValue(context.Background(), oauth2.HTTPClient, a.client))
+}
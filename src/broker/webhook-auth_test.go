@@ -0,0 +1,43 @@
+package broker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOAuth2Authorizer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, secret, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "beam", user)
+		assert.Equal(t, "secret", secret)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "abc", "token_type": "bearer", "expires_in": 3600}`))
+	}))
+	defer server.Close()
+
+	a := newOAuth2Authorizer(&model.WebhookAuth{Type: model.OAuth2Auth, TokenURL: server.URL, ClientID: "beam", ClientSecret: "secret"}, time.Second)
+	authorization, err := a.authorization()
+	assert.Nil(t, err)
+	assert.Equal(t, "Bearer abc", authorization)
+}
+
+func TestOAuth2AuthorizerTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	a := newOAuth2Authorizer(&model.WebhookAuth{Type: model.OAuth2Auth, TokenURL: server.URL, ClientID: "beam", ClientSecret: "secret"}, 50*time.Millisecond)
+	start := time.Now()
+	_, err := a.authorization()
+	assert.NotNil(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
@@ -0,0 +1,166 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// batchSizeHeader carries the number of messages in a batch delivery
+const batchSizeHeader = "PulsarBeam-Batch-Size"
+
+// batcher accumulates messages for a batch delivery
+type batcher struct {
+	maxMessages int
+	maxBytes    int
+	maxLinger   time.Duration
+	msgs        []pulsar.Message
+	bytes       int
+	deadline    time.Time
+}
+
+// newBatcher returns nil if the webhook does not enable batch delivery
+func newBatcher(whCfg model.WebhookConfig) (*batcher, error) {
+	if whCfg.Batch == nil {
+		return nil, nil
+	}
+	maxMessages, maxBytes, maxLinger, err := whCfg.Batch.Limits()
+	if err != nil {
+		return nil, err
+	}
+	return &batcher{
+		maxMessages: maxMessages,
+		maxBytes:    maxBytes,
+		maxLinger:   maxLinger,
+	}, nil
+}
+
+// fits checks if the message can be added without exceeding the max bytes
+func (b *batcher) fits(msg pulsar.Message) bool {
+	return len(b.msgs) == 0 || b.bytes+len(msg.Payload()) <= b.maxBytes
+}
+
+// add adds a message to the batch and returns true if the batch is full
+func (b *batcher) add(msg pulsar.Message) bool {
+	if len(b.msgs) == 0 {
+		b.deadline = time.Now().Add(b.maxLinger)
+	}
+	b.msgs = append(b.msgs, msg)
+	b.bytes += len(msg.Payload())
+	return len(b.msgs) >= b.maxMessages || b.bytes >= b.maxBytes
+}
+
+// take returns the accumulated messages and resets the batch
+func (b *batcher) take() []pulsar.Message {
+	msgs := b.msgs
+	b.msgs = nil
+	b.bytes = 0
+	return msgs
+}
+
+// receiveContext returns a context that expires at the linger deadline of a pending batch
+func (d *webhookDelivery) receiveContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d.batch == nil || len(d.batch.msgs) == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, d.batch.deadline)
+}
+
+// addToBatch adds a message to the batch and delivers the batch when it is full
+func (d *webhookDelivery) addToBatch(c pulsar.Consumer, msg pulsar.Message) {
+	if !d.batch.fits(msg) {
+		d.pushBatch(c, d.batch.take())
+	}
+	if d.batch.add(msg) {
+		d.pushBatch(c, d.batch.take())
+	}
+}
+
+// flushBatch delivers the pending batch
+func (d *webhookDelivery) flushBatch(c pulsar.Consumer) {
+	if d.batch != nil && len(d.batch.msgs) > 0 {
+		d.pushBatch(c, d.batch.take())
+	}
+}
+
+// pushBatch sends messages as a JSON array to the webhook, and acks or rejects them based on the response
+func (d *webhookDelivery) pushBatch(c pulsar.Consumer, msgs []pulsar.Message) {
+	batch := make([]model.WebhookBatchMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		batch = append(batch, model.NewWebhookBatchMessage(msg, DecodePayload(d.schema, msg)))
+	}
+	data, err := json.Marshal(batch)
+	if err != nil {
+		log.Errorf("failed to marshal webhook batch error %v", err)
+		for _, msg := range msgs {
+			c.Nack(msg)
+		}
+		return
+	}
+
+	headers := append([]string{}, d.headers...)
+	headers = append(headers, "content-type:application/json")
+	headers = append(headers, batchSizeHeader+":"+strconv.Itoa(len(msgs)))
+	headers = d.sign(headers, "", data)
+
+	d.stats.start()
+	code, res, err := d.send(data, headers)
+	defer drainResponse(res)
+	if code >= 200 && code < 300 {
+		d.stats.success(code)
+		failed := failedIndices(res)
+		for i, msg := range msgs {
+			if failed[i] {
+				d.reject(c, msg, code, "failed in a partial success batch")
+			} else {
+				c.Ack(msg)
+			}
+		}
+		return
+	}
+	if code == http.StatusUnprocessableEntity {
+		d.stats.success(code)
+		for _, msg := range msgs {
+			c.Ack(msg)
+		}
+		return
+	}
+
+	snippet := responseSnippet(res)
+	if err != nil {
+		d.stats.failure(code, err.Error())
+	} else {
+		d.stats.failure(code, "webhook returns status code "+strconv.Itoa(code)+" "+snippet)
+	}
+	for _, msg := range msgs {
+		d.reject(c, msg, code, snippet)
+	}
+}
+
+// failedIndices parses the optional partial success response body
+func failedIndices(res *http.Response) map[int]bool {
+	failed := make(map[int]bool)
+	if res == nil || res.Body == nil {
+		return failed
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil || len(b) == 0 {
+		return failed
+	}
+	var batchRes model.WebhookBatchResponse
+	if err := json.Unmarshal(b, &batchRes); err != nil {
+		return failed
+	}
+	for _, i := range batchRes.FailedIndices {
+		failed[i] = true
+	}
+	return failed
+}
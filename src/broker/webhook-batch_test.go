@@ -0,0 +1,109 @@
+package broker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// batchDelivery creates a webhook delivery to a server replying with the status code and body
+func batchDelivery(t *testing.T, code int, body string) (*webhookDelivery, func() [][]model.WebhookBatchMessage, func()) {
+	var requests [][]model.WebhookBatchMessage
+	var lock sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		var batch []model.WebhookBatchMessage
+		assert.Nil(t, json.Unmarshal(b, &batch))
+		assert.Equal(t, strconv.Itoa(len(batch)), r.Header.Get(batchSizeHeader))
+		lock.Lock()
+		requests = append(requests, batch)
+		lock.Unlock()
+		w.WriteHeader(code)
+		w.Write([]byte(body))
+	}))
+
+	whCfg := model.NewWebhookConfig(server.URL)
+	whCfg.RetryPolicy = &model.RetryPolicy{MaxRetries: 0}
+	subscriptionKey := "batch-test-" + t.Name()
+	delivery, err := newWebhookDelivery("pulsar://localhost:6650", "token", "persistent://ten/ns/topic", subscriptionKey, whCfg, nil)
+	assert.Nil(t, err)
+	received := func() [][]model.WebhookBatchMessage {
+		lock.Lock()
+		defer lock.Unlock()
+		return requests
+	}
+	return delivery, received, func() {
+		server.Close()
+		deleteDeliveryStats(subscriptionKey)
+	}
+}
+
+func batchMessages() []pulsar.Message {
+	return []pulsar.Message{
+		&mockMessage{key: "0", payload: []byte(`{"n":0}`)},
+		&mockMessage{key: "1", payload: []byte(`{"n":1}`)},
+		&mockMessage{key: "2", payload: []byte(`{"n":2}`)},
+	}
+}
+
+func TestWebhookBatchPartialSuccess(t *testing.T) {
+	delivery, requests, cleanup := batchDelivery(t, http.StatusOK, `{"failedIndices": [0, 2]}`)
+	defer cleanup()
+
+	consumer := &mockConsumer{}
+	msgs := batchMessages()
+	delivery.pushBatch(consumer, msgs)
+
+	batches := requests()
+	assert.Equal(t, 1, len(batches))
+	assert.Equal(t, 3, len(batches[0]))
+	assert.Equal(t, json.RawMessage(`{"n":1}`), batches[0][1].Payload)
+	acked, nacked := consumer.settled()
+	assert.Equal(t, []pulsar.Message{msgs[1]}, acked)
+	assert.Equal(t, []pulsar.Message{msgs[0], msgs[2]}, nacked)
+}
+
+func TestWebhookBatchSuccess(t *testing.T) {
+	delivery, _, cleanup := batchDelivery(t, http.StatusNoContent, "")
+	defer cleanup()
+
+	consumer := &mockConsumer{}
+	msgs := batchMessages()
+	delivery.pushBatch(consumer, msgs)
+	acked, nacked := consumer.settled()
+	assert.Equal(t, msgs, acked)
+	assert.Empty(t, nacked)
+}
+
+func TestWebhookBatchUnprocessable(t *testing.T) {
+	delivery, _, cleanup := batchDelivery(t, http.StatusUnprocessableEntity, `{"failedIndices": [1]}`)
+	defer cleanup()
+
+	// a 422 reply acks the whole batch and ignores the failed indices
+	consumer := &mockConsumer{}
+	msgs := batchMessages()
+	delivery.pushBatch(consumer, msgs)
+	acked, nacked := consumer.settled()
+	assert.Equal(t, msgs, acked)
+	assert.Empty(t, nacked)
+}
+
+func TestWebhookBatchFailure(t *testing.T) {
+	delivery, _, cleanup := batchDelivery(t, http.StatusBadGateway, "")
+	defer cleanup()
+
+	consumer := &mockConsumer{}
+	msgs := batchMessages()
+	delivery.pushBatch(consumer, msgs)
+	acked, nacked := consumer.settled()
+	assert.Empty(t, acked)
+	assert.Equal(t, msgs, nacked)
+}
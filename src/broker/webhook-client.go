@@ -0,0 +1,68 @@
+package broker
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+)
+
+// newWebhookClient creates a retryable HTTP client based on the webhook's retry policy.
+// The client is shared by all deliveries of the same webhook so that the underlying
+// pooled transport can reuse TCP connections.
+func newWebhookClient(whCfg model.WebhookConfig) (*retryablehttp.Client, error) {
+	policy := model.GetRetryPolicy(whCfg)
+	minBackoff, maxBackoff, timeout, err := policy.Durations()
+	if err != nil {
+		return nil, err
+	}
+
+	client := retryablehttp.NewClient()
+	client.RetryWaitMin = minBackoff
+	client.RetryWaitMax = maxBackoff
+	client.RetryMax = policy.MaxRetries
+	client.HTTPClient.Timeout = timeout
+	// return the last response rather than an error so the status code and body can be examined
+	client.ErrorHandler = retryablehttp.PassthroughErrorHandler
+
+	if len(policy.RetryableStatusCodes) > 0 {
+		client.CheckRetry = statusCodeRetryPolicy(policy.RetryableStatusCodes)
+	}
+	if policy.Jitter {
+		client.Backoff = jitterBackoff
+	}
+	return client, nil
+}
+
+// statusCodeRetryPolicy only retries on connection errors and the specified status codes
+func statusCodeRetryPolicy(codes []int) retryablehttp.CheckRetry {
+	retryable := make(map[int]bool, len(codes))
+	for _, code := range codes {
+		retryable[code] = true
+	}
+	return func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		if err != nil || resp == nil {
+			return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+		}
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		return retryable[resp.StatusCode], nil
+	}
+}
+
+// jitterBackoff randomizes the exponential backoff between min and the exponential wait time
+// The wait time dictated by a Retry-After header is honored as is.
+func jitterBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	wait := retryablehttp.DefaultBackoff(min, max, attemptNum, resp)
+	if resp != nil && resp.Header.Get("Retry-After") != "" {
+		return wait
+	}
+	if wait <= min {
+		return wait
+	}
+	return min + time.Duration(rand.Int63n(int64(wait-min)))
+}
@@ -0,0 +1,116 @@
+package broker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kafkaesque-io/pulsar-beam/src/db"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// deliveryStatsCache keeps the delivery stats of webhooks run by this broker
+// key is the webhook subscription key
+// The stats are written to the database periodically, from which the REST API of any process serves them.
+var deliveryStatsCache = make(map[string]*deliveryStats)
+
+var deliveryStatsSync = &sync.RWMutex{}
+
+// deliveryStats is the thread safe delivery stats of a webhook
+// dirty is set when the stats change after they are written to the database.
+type deliveryStats struct {
+	stats model.WebhookDeliveryStats
+	dirty bool
+	sync.Mutex
+}
+
+// SubscriptionKey returns the key to identify a webhook subscription of a topic
+func SubscriptionKey(topicKey string, whCfg model.WebhookConfig) string {
+	return topicKey + whCfg.URL
+}
+
+// getDeliveryStats gets or creates the delivery stats of a webhook
+func getDeliveryStats(subscriptionKey string) *deliveryStats {
+	deliveryStatsSync.Lock()
+	defer deliveryStatsSync.Unlock()
+	s, ok := deliveryStatsCache[subscriptionKey]
+	if !ok {
+		s = &deliveryStats{}
+		deliveryStatsCache[subscriptionKey] = s
+	}
+	return s
+}
+
+// deleteDeliveryStats removes the delivery stats of a webhook
+func deleteDeliveryStats(subscriptionKey string) {
+	deliveryStatsSync.Lock()
+	defer deliveryStatsSync.Unlock()
+	delete(deliveryStatsCache, subscriptionKey)
+}
+
+// flushDeliveryStats writes the changed delivery stats to the database
+func flushDeliveryStats(dbHandler db.Crud) {
+	deliveryStatsSync.RLock()
+	all := make(map[string]*deliveryStats)
+	for key, s := range deliveryStatsCache {
+		all[key] = s
+	}
+	deliveryStatsSync.RUnlock()
+
+	for key, s := range all {
+		s.Lock()
+		stats, dirty := s.stats, s.dirty
+		s.dirty = false
+		s.Unlock()
+		if !dirty {
+			continue
+		}
+		if err := dbHandler.SaveWebhookStats(key, stats); err != nil {
+			log.Errorf("failed to save webhook %s delivery stats error %v", key, err)
+			s.Lock()
+			s.dirty = true
+			s.Unlock()
+		}
+	}
+}
+
+// start marks a delivery in flight
+func (s *deliveryStats) start() {
+	s.Lock()
+	defer s.Unlock()
+	s.stats.InFlight++
+	s.dirty = true
+}
+
+// success records a successful delivery
+func (s *deliveryStats) success(code int) {
+	s.Lock()
+	defer s.Unlock()
+	s.stats.InFlight--
+	s.stats.LastSuccessAt = time.Now()
+	s.stats.LastStatusCode = code
+	s.stats.ConsecutiveFailures = 0
+	s.stats.Delivered++
+	s.dirty = true
+}
+
+// failure records a failed delivery
+func (s *deliveryStats) failure(code int, errStr string) {
+	s.Lock()
+	defer s.Unlock()
+	s.stats.InFlight--
+	s.stats.LastFailureAt = time.Now()
+	s.stats.LastStatusCode = code
+	s.stats.LastError = errStr
+	s.stats.ConsecutiveFailures++
+	s.stats.Failed++
+	s.dirty = true
+}
+
+// resetFailures resets the consecutive failures once a suspended webhook recovers
+func (s *deliveryStats) resetFailures() {
+	s.Lock()
+	defer s.Unlock()
+	s.stats.ConsecutiveFailures = 0
+	s.dirty = true
+}
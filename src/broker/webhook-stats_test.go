@@ -0,0 +1,62 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kafkaesque-io/pulsar-beam/src/db"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingDb counts the stats writes and fails them on demand
+type countingDb struct {
+	db.Crud
+	saves int
+	fail  bool
+}
+
+func (c *countingDb) SaveWebhookStats(subscriptionKey string, stats model.WebhookDeliveryStats) error {
+	c.saves++
+	if c.fail {
+		return errors.New("db is down")
+	}
+	return c.Crud.SaveWebhookStats(subscriptionKey, stats)
+}
+
+func TestFlushDeliveryStats(t *testing.T) {
+	dbHandler, err := db.NewInMemoryHandler()
+	assert.Nil(t, err)
+	store := &countingDb{Crud: dbHandler}
+
+	subscriptionKey := SubscriptionKey("stats-topic-key", model.NewWebhookConfig("http://localhost:8089"))
+	defer deleteDeliveryStats(subscriptionKey)
+	stats := getDeliveryStats(subscriptionKey)
+	stats.start()
+	stats.success(200)
+
+	flushDeliveryStats(store)
+	assert.Equal(t, 1, store.saves)
+	saved, err := dbHandler.GetWebhookStats(subscriptionKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), saved.Delivered)
+	assert.Equal(t, 200, saved.LastStatusCode)
+
+	// unchanged stats are not written again
+	flushDeliveryStats(store)
+	assert.Equal(t, 1, store.saves)
+
+	// a failed write is retried at the next flush
+	stats.start()
+	stats.failure(500, "internal error")
+	store.fail = true
+	flushDeliveryStats(store)
+	assert.Equal(t, 2, store.saves)
+	store.fail = false
+	flushDeliveryStats(store)
+	assert.Equal(t, 3, store.saves)
+	saved, err = dbHandler.GetWebhookStats(subscriptionKey)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), saved.Failed)
+	assert.Equal(t, "internal error", saved.LastError)
+}
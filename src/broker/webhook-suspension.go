@@ -0,0 +1,121 @@
+package broker
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+)
+
+// Webhook suspension state machine
+// An activated webhook is suspended after a configured number of consecutive delivery failures.
+// Its consumer is closed but the subscription is kept so that no message is lost.
+// A suspended webhook is probed periodically and activated again once a probe succeeds.
+// The webhook broker resumes the subscription when it loads the activated webhook from the database.
+
+// probeHeader is sent with the probe request so that a webhook can tell it from a message delivery
+const probeHeader = "PulsarBeam-Probe:true"
+
+// shouldSuspend checks if the webhook reaches the consecutive failure threshold
+func (wb *WebhookBroker) shouldSuspend(stats *deliveryStats) bool {
+	if wb.suspendAfter <= 0 {
+		return false
+	}
+	stats.Lock()
+	defer stats.Unlock()
+	return stats.stats.ConsecutiveFailures >= wb.suspendAfter
+}
+
+// suspendWebhook persists the Suspended status of the webhook and starts to probe it
+func (wb *WebhookBroker) suspendWebhook(topicKey string, whCfg model.WebhookConfig, delivery *webhookDelivery) error {
+	reason := fmt.Sprintf("suspended after %d consecutive delivery failures", wb.suspendAfter)
+	if err := wb.updateWebhookStatus(topicKey, whCfg.URL, model.Activated, model.Suspended, reason); err != nil {
+		return err
+	}
+	wb.l.Warnf("webhook %s of topic %s is suspended", whCfg.URL, topicKey)
+	if wb.startProbing(SubscriptionKey(topicKey, whCfg)) {
+		go wb.probeLoop(topicKey, whCfg, delivery)
+	}
+	return nil
+}
+
+// startProbing flags a webhook being probed, returns false if it is already being probed
+func (wb *WebhookBroker) startProbing(subscriptionKey string) bool {
+	wb.Lock()
+	defer wb.Unlock()
+	if wb.probes[subscriptionKey] {
+		return false
+	}
+	wb.probes[subscriptionKey] = true
+	return true
+}
+
+// stopProbing removes the probing flag of a webhook
+func (wb *WebhookBroker) stopProbing(subscriptionKey string) {
+	wb.Lock()
+	defer wb.Unlock()
+	delete(wb.probes, subscriptionKey)
+}
+
+// probeLoop probes a suspended webhook until it recovers, or it is no longer suspended in the database
+// The caller must flag the webhook being probed by startProbing, so that a webhook has one probe loop at a time.
+func (wb *WebhookBroker) probeLoop(topicKey string, whCfg model.WebhookConfig, delivery *webhookDelivery) {
+	defer wb.stopProbing(SubscriptionKey(topicKey, whCfg))
+
+	ticker := time.NewTicker(wb.probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !wb.isSuspended(topicKey, whCfg.URL) {
+				wb.l.Infof("stop probing webhook %s of topic %s that is no longer suspended", whCfg.URL, topicKey)
+				return
+			}
+			if !delivery.probe() {
+				continue
+			}
+			err := wb.updateWebhookStatus(topicKey, whCfg.URL, model.Suspended, model.Activated, "activated after a successful probe")
+			if err != nil {
+				wb.l.Errorf("failed to activate recovered webhook %s of topic %s error %v", whCfg.URL, topicKey, err)
+				continue
+			}
+			delivery.stats.resetFailures()
+			wb.l.Infof("webhook %s of topic %s is activated after recovery", whCfg.URL, topicKey)
+			return
+		case <-wb.ctx.Done():
+			return
+		}
+	}
+}
+
+// isSuspended checks if the webhook is still suspended in the database
+func (wb *WebhookBroker) isSuspended(topicKey, url string) bool {
+	doc, err := wb.dbHandler.GetByKey(topicKey)
+	if err != nil {
+		return false
+	}
+	for _, wh := range doc.Webhooks {
+		if wh.URL == url {
+			return wh.WebhookStatus == model.Suspended
+		}
+	}
+	return false
+}
+
+// updateWebhookStatus transitions the webhook status in the topic document
+// Only the status of the webhook is written, so a topic update by the REST API in the meantime is kept.
+func (wb *WebhookBroker) updateWebhookStatus(topicKey, url string, from, to model.Status, reason string) error {
+	return wb.dbHandler.UpdateWebhookStatus(topicKey, url, from, to, reason)
+}
+
+// probe sends a request with an empty body and the PulsarBeam-Probe:true header to the webhook, so that
+// the webhook can tell it from a message delivery. A 2xx or 422 reply means the webhook recovers.
+func (d *webhookDelivery) probe() bool {
+	headers := append([]string{}, d.headers...)
+	headers = append(headers, probeHeader)
+	headers = d.sign(headers, "", []byte{})
+	code, res, _ := d.send([]byte{}, headers)
+	drainResponse(res)
+	return (code >= 200 && code < 300) || code == http.StatusUnprocessableEntity
+}
@@ -0,0 +1,89 @@
+package broker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kafkaesque-io/pulsar-beam/src/db"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookSuspension(t *testing.T) {
+	var status, probes int32 = http.StatusInternalServerError, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PulsarBeam-Probe") == "true" {
+			atomic.AddInt32(&probes, 1)
+		}
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	dbHandler, err := db.NewInMemoryHandler()
+	assert.Nil(t, err)
+	topic, err := model.NewTopicConfig("persistent://ten/ns/suspension", "pulsar://localhost:6650", "token")
+	assert.Nil(t, err)
+	whCfg := model.NewWebhookConfig(server.URL)
+	whCfg.RetryPolicy = &model.RetryPolicy{MaxRetries: 0}
+	topic.Webhooks = []model.WebhookConfig{whCfg}
+	topicKey, err := dbHandler.Create(&topic)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wb := &WebhookBroker{
+		dbHandler:     dbHandler,
+		webhooks:      make(map[string]chan *SubCloseSignal),
+		l:             log.WithFields(log.Fields{"app": "test"}),
+		suspendAfter:  2,
+		probeInterval: 10 * time.Millisecond,
+		probes:        make(map[string]bool),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+	subscriptionKey := SubscriptionKey(topicKey, whCfg)
+	defer deleteDeliveryStats(subscriptionKey)
+	delivery, err := newWebhookDelivery(topic.PulsarURL, topic.Token, topic.TopicFullName, subscriptionKey, whCfg, nil)
+	assert.Nil(t, err)
+
+	// the webhook is suspended once the consecutive failures reach the threshold
+	consumer := &mockConsumer{}
+	delivery.push(consumer, &mockMessage{payload: []byte("1")})
+	assert.False(t, wb.shouldSuspend(delivery.stats))
+	delivery.push(consumer, &mockMessage{payload: []byte("2")})
+	assert.True(t, wb.shouldSuspend(delivery.stats))
+	_, nacked := consumer.settled()
+	assert.Equal(t, 2, len(nacked))
+
+	assert.Nil(t, wb.suspendWebhook(topicKey, whCfg, delivery))
+	assert.True(t, wb.isSuspended(topicKey, whCfg.URL))
+	assert.Eventually(t, func() bool { return wb.isProbing(subscriptionKey) }, time.Second, 5*time.Millisecond)
+
+	// a database poll does not start a second probe loop of the webhook being probed
+	assert.False(t, wb.startProbing(subscriptionKey))
+	wb.run()
+	_, running := wb.ReadWebhook(subscriptionKey)
+	assert.False(t, running)
+
+	// the failing probes keep the webhook suspended until the webhook recovers
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&probes) >= 2 }, time.Second, 5*time.Millisecond)
+	assert.True(t, wb.isSuspended(topicKey, whCfg.URL))
+	atomic.StoreInt32(&status, http.StatusOK)
+	assert.Eventually(t, func() bool {
+		doc, err := dbHandler.GetByKey(topicKey)
+		return err == nil && doc.Webhooks[0].WebhookStatus == model.Activated
+	}, time.Second, 5*time.Millisecond)
+	assert.False(t, wb.shouldSuspend(delivery.stats))
+	assert.Eventually(t, func() bool { return !wb.isProbing(subscriptionKey) }, time.Second, 5*time.Millisecond)
+}
+
+func (wb *WebhookBroker) isProbing(subscriptionKey string) bool {
+	wb.RLock()
+	defer wb.RUnlock()
+	return wb.probes[subscriptionKey]
+}
@@ -0,0 +1,80 @@
+package broker
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+)
+
+// queuedMessage is a message to be delivered with the consumer that received it
+type queuedMessage struct {
+	c   pulsar.Consumer
+	msg pulsar.Message
+}
+
+// deliveryWorkers runs concurrent delivery workers off one consumer.
+// Messages are dispatched to any idle worker on a shared subscription.
+// On a key_shared subscription, messages with the same key are always dispatched to
+// the same worker so that the per key ordering is preserved.
+type deliveryWorkers struct {
+	queues []chan queuedMessage
+	keyed  bool
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// newDeliveryWorkers starts n workers that call push for every dispatched message
+func newDeliveryWorkers(n int, keyed bool, push func(pulsar.Consumer, pulsar.Message)) *deliveryWorkers {
+	w := &deliveryWorkers{keyed: keyed}
+	if keyed {
+		w.queues = make([]chan queuedMessage, n)
+		for i := range w.queues {
+			w.queues[i] = make(chan queuedMessage, 1)
+		}
+	} else {
+		w.queues = []chan queuedMessage{make(chan queuedMessage, n)}
+	}
+
+	for i := 0; i < n; i++ {
+		queue := w.queues[i%len(w.queues)]
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			for d := range queue {
+				push(d.c, d.msg)
+			}
+		}()
+	}
+	return w
+}
+
+// dispatch blocks until a worker can take the message
+func (w *deliveryWorkers) dispatch(c pulsar.Consumer, msg pulsar.Message) {
+	i := 0
+	if w.keyed {
+		i = keyIndex(msg, len(w.queues))
+	}
+	w.queues[i] <- queuedMessage{c: c, msg: msg}
+}
+
+// stop waits for all dispatched messages to be delivered, it can be called more than once
+func (w *deliveryWorkers) stop() {
+	w.once.Do(func() {
+		for _, queue := range w.queues {
+			close(queue)
+		}
+		w.wg.Wait()
+	})
+}
+
+// keyIndex hashes the ordering key, or the message key, to a worker index
+func keyIndex(msg pulsar.Message, n int) int {
+	key := msg.OrderingKey()
+	if key == "" {
+		key = msg.Key()
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
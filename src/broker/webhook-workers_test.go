@@ -0,0 +1,57 @@
+package broker
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeySharedWorkersOrdering(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	delivered := make(map[string][]int)
+	var lock sync.Mutex
+	workers := newDeliveryWorkers(4, true, func(c pulsar.Consumer, msg pulsar.Message) {
+		seq, _ := strconv.Atoi(string(msg.Payload()))
+		// uneven delivery latency reorders the messages unless the same key stays on one worker
+		time.Sleep(time.Duration(seq%3) * time.Millisecond)
+		lock.Lock()
+		delivered[msg.Key()] = append(delivered[msg.Key()], seq)
+		lock.Unlock()
+	})
+
+	const perKey = 20
+	var expected []int
+	for seq := 0; seq < perKey; seq++ {
+		expected = append(expected, seq)
+		for _, key := range keys {
+			workers.dispatch(nil, &mockMessage{key: key, payload: []byte(strconv.Itoa(seq))})
+		}
+	}
+	workers.stop()
+
+	assert.Equal(t, len(keys), len(delivered))
+	for _, key := range keys {
+		assert.Equal(t, expected, delivered[key], "key %s is delivered out of order", key)
+	}
+}
+
+func TestSharedWorkersDelivery(t *testing.T) {
+	var lock sync.Mutex
+	delivered := 0
+	workers := newDeliveryWorkers(4, false, func(c pulsar.Consumer, msg pulsar.Message) {
+		lock.Lock()
+		delivered++
+		lock.Unlock()
+	})
+	for i := 0; i < 50; i++ {
+		workers.dispatch(nil, &mockMessage{key: strconv.Itoa(i)})
+	}
+	// stop waits for every dispatched message and can be called again
+	workers.stop()
+	workers.stop()
+	assert.Equal(t, 50, delivered)
+}
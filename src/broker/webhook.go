@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -14,6 +16,7 @@ import (
 	"github.com/apache/pulsar-client-go/pulsar"
 	"github.com/hashicorp/go-retryablehttp"
 	"github.com/kafkaesque-io/pulsar-beam/src/db"
+	"github.com/kafkaesque-io/pulsar-beam/src/icrypto"
 	"github.com/kafkaesque-io/pulsar-beam/src/model"
 	"github.com/kafkaesque-io/pulsar-beam/src/pulsardriver"
 	"github.com/kafkaesque-io/pulsar-beam/src/util"
@@ -26,17 +29,47 @@ type WebhookBroker struct {
 	webhooks  map[string]chan *SubCloseSignal
 	dbHandler db.Db
 	l         *log.Entry
+	// the number of consecutive failures to suspend a webhook, 0 disables suspension
+	suspendAfter  int
+	probeInterval time.Duration
+	// suspended webhooks being probed, key is the subscription key
+	probes map[string]bool
+	// ctx is cancelled to shut down the broker
+	ctx    context.Context
+	cancel context.CancelFunc
+	// consumers keeps track of running consumer loops
+	consumers sync.WaitGroup
 	sync.RWMutex
 }
 
+// webhookBroker is the broker instance started by Init
+var webhookBroker *WebhookBroker
+
 // SubCloseSignal is a signal object to pass for channel
 type SubCloseSignal struct{}
 
 func NewWebhookBroker(config *util.Configuration) *WebhookBroker {
+	l := log.WithFields(log.Fields{"app": "webhookbroker"})
+	suspendAfter, err := strconv.Atoi(util.AssignString(config.WebhookSuspendFailures, "0"))
+	if err != nil {
+		l.Errorf("specified webhook suspend failures %s error %v", config.WebhookSuspendFailures, err)
+	}
+	probeStr := util.AssignString(config.WebhookProbeInterval, "60s")
+	probeInterval, err := time.ParseDuration(probeStr)
+	if err != nil || probeInterval <= 0 {
+		l.Errorf("specified webhook probe interval %s error %v", probeStr, err)
+		probeInterval = 60 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &WebhookBroker{
-		dbHandler: db.NewDbWithPanic(config.PbDbType),
-		webhooks:  make(map[string]chan *SubCloseSignal),
-		l:         log.WithFields(log.Fields{"app": "webhookbroker"}),
+		dbHandler:     db.NewDbWithPanic(config.PbDbType),
+		webhooks:      make(map[string]chan *SubCloseSignal),
+		l:             l,
+		suspendAfter:  suspendAfter,
+		probeInterval: probeInterval,
+		probes:        make(map[string]bool),
+		ctx:           ctx,
+		cancel:        cancel,
 	}
 }
 
@@ -55,6 +88,18 @@ func (wb *WebhookBroker) WriteWebhook(key string, c chan *SubCloseSignal) {
 	wb.webhooks[key] = c
 }
 
+// webhookKeys returns a copy of the keys of the running webhooks
+// since a consumer loop deletes its key from the map when it closes itself.
+func (wb *WebhookBroker) webhookKeys() []string {
+	wb.RLock()
+	defer wb.RUnlock()
+	keys := make([]string, 0, len(wb.webhooks))
+	for k := range wb.webhooks {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
 // DeleteWebhook deletes a key from a thread safe map
 func (wb *WebhookBroker) DeleteWebhook(key string) bool {
 	wb.Lock()
@@ -78,6 +123,26 @@ func Init(config *util.Configuration) {
 		duration, _ = time.ParseDuration("180s")
 	}
 	svr.l.Infof("beam database pull every %.0f seconds", duration.Seconds())
+	webhookBroker = svr
+
+	statsStr := util.AssignString(config.WebhookStatsInterval, "10s")
+	statsInterval, err := time.ParseDuration(statsStr)
+	if err != nil || statsInterval <= 0 {
+		svr.l.Errorf("specified webhook stats interval %s error %v", statsStr, err)
+		statsInterval = 10 * time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(statsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				flushDeliveryStats(svr.dbHandler)
+			case <-svr.ctx.Done():
+				return
+			}
+		}
+	}()
 
 	go func() {
 		svr.run()
@@ -87,23 +152,46 @@ func Init(config *util.Configuration) {
 			select {
 			case <-ticker.C:
 				svr.run()
+			case <-svr.ctx.Done():
+				return
 			}
 		}
 	}()
 }
 
-// pushWebhook sends data to a webhook interface
-func pushWebhook(url string, data []byte, headers []string) (int, *http.Response) {
+// Shutdown stops the broker started by Init from loading webhooks, and waits for
+// the in-flight webhook deliveries to finish until the context is done
+func Shutdown(ctx context.Context) error {
+	if webhookBroker == nil {
+		return nil
+	}
+	return webhookBroker.Shutdown(ctx)
+}
 
-	client := retryablehttp.NewClient()
-	client.RetryWaitMin = 2 * time.Second
-	client.RetryWaitMax = 28 * time.Second
-	client.RetryMax = 1
+// Shutdown stops all consumer loops and waits for the in-flight deliveries to finish until the context is done
+func (wb *WebhookBroker) Shutdown(ctx context.Context) error {
+	wb.cancel()
+	done := make(chan struct{})
+	go func() {
+		wb.consumers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		wb.l.Infof("all webhook consumers have stopped")
+		flushDeliveryStats(wb.dbHandler)
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("webhook consumers failed to stop in time %v", ctx.Err())
+	}
+}
 
-	req, err := retryablehttp.NewRequest("POST", url, data)
+// pushWebhook sends data to a webhook interface
+func pushWebhook(client *retryablehttp.Client, method, url string, data []byte, headers []string) (int, *http.Response, error) {
+	req, err := retryablehttp.NewRequest(method, url, data)
 	if err != nil {
 		log.Errorf("url request error %s", err.Error())
-		return http.StatusInternalServerError, nil
+		return http.StatusInternalServerError, nil, err
 	}
 
 	for _, h := range headers {
@@ -119,15 +207,17 @@ func pushWebhook(url string, data []byte, headers []string) (int, *http.Response
 	res, err := client.Do(req)
 	if err != nil {
 		log.Debugf("webhook post error %s", err.Error())
-		return http.StatusInternalServerError, nil
+		return http.StatusInternalServerError, nil, err
 	}
 
 	if log.GetLevel() == log.DebugLevel {
 		log.Debugf("webhook endpoint resp status code %d", res.StatusCode)
 	}
-	return res.StatusCode, res
+	return res.StatusCode, res, nil
 }
 
+// toPulsar sends the webhook reply body to the Pulsar topic specified in the reply headers, if any
+// The body is read before the function returns, so that the caller can drain and close the response.
 func toPulsar(r *http.Response) {
 	token, topicFN, pulsarURL, err := util.ReceiverHeader(util.AllowedPulsarURLs, &r.Header)
 	if err != nil {
@@ -138,39 +228,278 @@ func toPulsar(r *http.Response) {
 	}
 
 	b, err2 := ioutil.ReadAll(r.Body)
-	defer r.Body.Close()
 	if err2 != nil {
 		log.Errorf("failed to read webhook resp body %s\n", err2.Error())
 		return
 	}
 
-	err3 := pulsardriver.SendToPulsar(pulsarURL, token, topicFN, b, true)
-	if err3 != nil {
-		return
+	go pulsardriver.SendToPulsar(pulsarURL, token, topicFN, b, true)
+}
+
+// webhookDelivery holds the objects shared by every message delivery of a webhook
+type webhookDelivery struct {
+	url         string
+	method      string
+	contentType string
+	headers     []string
+	auth        webhookAuthorizer
+	secret      []byte
+	client      *retryablehttp.Client
+	dlq         *deadLetter
+	stats       *deliveryStats
+	batch       *batcher
+	schema      *model.TopicSchema
+	filter      *model.Filter
+	template    *model.WebhookRenderer
+}
+
+// newWebhookDelivery creates the delivery objects of a webhook
+func newWebhookDelivery(url, token, topic, subscriptionKey string, whCfg model.WebhookConfig, schema *model.TopicSchema) (*webhookDelivery, error) {
+	client, err := newWebhookClient(whCfg)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := model.GetSigningSecret(whCfg)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := newWebhookAuthorizer(whCfg)
+	if err != nil {
+		return nil, err
+	}
+	batch, err := newBatcher(whCfg)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := model.ParseFilter(whCfg.Filter)
+	if err != nil {
+		return nil, err
+	}
+	renderer, err := model.CompileWebhookTemplate(whCfg.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &webhookDelivery{
+		url:         whCfg.URL,
+		method:      model.GetWebhookMethod(whCfg),
+		contentType: whCfg.ContentType,
+		headers:     whCfg.Headers,
+		auth:        auth,
+		secret:      secret,
+		client:      client,
+		dlq:         newDeadLetter(url, token, topic, whCfg),
+		stats:       getDeliveryStats(subscriptionKey),
+		batch:       batch,
+		schema:      schema,
+		filter:      filter,
+		template:    renderer,
+	}, nil
+}
+
+// filtered returns true if the message does not match the webhook filter
+func (d *webhookDelivery) filtered(msg pulsar.Message) bool {
+	if d.filter == nil {
+		return false
+	}
+	var payload []byte
+	if d.filter.UsesPayload() {
+		payload = DecodePayload(d.schema, msg)
+	}
+	return Filtered(d.filter, WebhookConsumer, msg, payload)
+}
+
+// sign adds the signature headers if the webhook has a signing secret
+// msgID is the base64 encoded message id, or empty for a batch or probe request.
+func (d *webhookDelivery) sign(headers []string, msgID string, data []byte) []string {
+	if d.secret == nil {
+		return headers
+	}
+	ts := time.Now().Unix()
+	if msgID != "" {
+		headers = append(headers, icrypto.WebhookMessageIDHeader+":"+msgID)
+	}
+	headers = append(headers, icrypto.WebhookTimestampHeader+":"+strconv.FormatInt(ts, 10))
+	return append(headers, icrypto.WebhookSignatureHeader+":"+icrypto.SignWebhook(d.secret, ts, msgID, data))
+}
+
+// send pushes the request to the webhook with the configured method and authorization
+// A cached OAuth2 token is discarded if the webhook replies 401, so that the redelivery uses a new token.
+func (d *webhookDelivery) send(data []byte, headers []string) (int, *http.Response, error) {
+	if d.auth != nil {
+		authorization, err := d.auth.authorization()
+		if err != nil {
+			log.Errorf("failed to authorize webhook %s request error %v", d.url, err)
+			return http.StatusInternalServerError, nil, fmt.Errorf("failed to authorize webhook request %v", err)
+		}
+		headers = append(headers, "Authorization:"+authorization)
+	}
+	code, res, err := pushWebhook(d.client, d.method, d.url, data, headers)
+	if code == http.StatusUnauthorized && d.auth != nil {
+		d.auth.invalidate()
 	}
+	return code, res, err
 }
 
-func pushAndAck(c pulsar.Consumer, msg pulsar.Message, url string, data []byte, headers []string) {
-	code, res := pushWebhook(url, data, headers)
+// push sends a single message with its metadata in headers to the webhook
+func (d *webhookDelivery) push(c pulsar.Consumer, msg pulsar.Message) {
+	// headers are built per message so that no header is carried over from the previous message
+	headers := append([]string{}, d.headers...)
+	msgID := fmt.Sprintf("%#v", msg.ID())
+	headers = append(headers, "PulsarMessageId:"+msgID)
+	headers = append(headers, "PulsarPublishedTime:"+msg.PublishTime().String())
+	headers = append(headers, "PulsarTopic:"+msg.Topic())
+	nilTime := time.Time{}
+	if msg.EventTime() != nilTime {
+		headers = append(headers, "PulsarEventTime:"+msg.EventTime().String())
+	}
+	for k, v := range msg.Properties() {
+		headers = append(headers, "PulsarProperties-"+k+":"+v)
+	}
+
+	data := DecodePayload(d.schema, msg)
+	if d.template != nil {
+		body, templateHeaders, err := d.template.Render(model.NewTemplateData(msg, data))
+		if err != nil {
+			// the endpoint is not at fault, so the failure does not count towards the webhook suspension
+			log.Errorf("failed to render webhook template for message %s error %v", msgID, err)
+			d.reject(c, msg, 0, "template error "+err.Error())
+			return
+		}
+		if body != nil {
+			data = body
+		}
+		headers = append(headers, templateHeaders...)
+	}
+	if d.contentType != "" {
+		headers = append(headers, "content-type:"+d.contentType)
+	} else if json.Valid(data) {
+		headers = append(headers, "content-type:application/json")
+	}
+	headers = d.sign(headers, model.MessageIDString(msg.ID()), data)
+	d.pushAndAck(c, msg, data, headers)
+}
+
+func (d *webhookDelivery) pushAndAck(c pulsar.Consumer, msg pulsar.Message, data []byte, headers []string) {
+	d.stats.start()
+	code, res, err := d.send(data, headers)
+	defer drainResponse(res)
 	if (code >= 200 && code < 300) || code == http.StatusUnprocessableEntity {
+		d.stats.success(code)
 		c.Ack(msg)
 
 		if code >= 200 && code < 300 {
-			go toPulsar(res)
+			toPulsar(res)
 		}
+		return
+	}
+
+	snippet := responseSnippet(res)
+	if err != nil {
+		d.stats.failure(code, err.Error())
 	} else {
-		if log.GetLevel() == log.DebugLevel {
-			// replying on Pulsar to redeliver
-			log.Errorf("webhook returns non-OK statuscode %d\n", code)
+		d.stats.failure(code, fmt.Sprintf("webhook returns status code %d %s", code, snippet))
+	}
+
+	// the message is negatively acked for Pulsar to redeliver unless it is routed to the dead-letter topic
+	d.reject(c, msg, code, snippet)
+}
+
+// reject routes a failed message to the dead-letter topic once it exhausts the delivery attempts,
+// otherwise negatively acks the message for redelivery
+func (d *webhookDelivery) reject(c pulsar.Consumer, msg pulsar.Message, code int, reason string) {
+	if d.dlq != nil && d.dlq.exhausted(msg) {
+		if err := d.dlq.send(msg, code, reason); err != nil {
+			log.Errorf("failed to route message to dead-letter topic %s error %v", d.dlq.topic, err)
+		} else {
+			c.Ack(msg)
+			return
 		}
 	}
+	c.Nack(msg)
+}
+
+// the maximum length of the webhook response body kept in a dead-letter message property
+const responseSnippetSize = 256
+
+// responseSnippet reads the beginning of a webhook response body
+func responseSnippet(res *http.Response) string {
+	if res == nil || res.Body == nil {
+		return ""
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, responseSnippetSize))
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// drainResponse reads the rest of a webhook response body and closes it,
+// so that the connection is returned to the pool of the shared webhook client
+func drainResponse(res *http.Response) {
+	if res == nil || res.Body == nil {
+		return
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+}
+
+// deadLetter is the dead-letter destination of a webhook
+type deadLetter struct {
+	topic         string
+	maxDeliveries uint32
+	// publish sends a message to the dead-letter topic
+	publish func(msg *pulsar.ProducerMessage) error
+}
+
+// newDeadLetter returns nil if the webhook has no dead-letter policy
+func newDeadLetter(pulsarURL, token, topic string, whCfg model.WebhookConfig) *deadLetter {
+	if whCfg.DeadLetterPolicy.MaxDeliveries == 0 {
+		return nil
+	}
+	dlqTopic := model.GetDeadLetterTopic(topic, whCfg)
+	return &deadLetter{
+		topic:         dlqTopic,
+		maxDeliveries: whCfg.DeadLetterPolicy.MaxDeliveries,
+		publish: func(msg *pulsar.ProducerMessage) error {
+			p, err := pulsardriver.GetPulsarProducer(pulsarURL, token, dlqTopic, nil)
+			if err != nil {
+				return err
+			}
+			_, err = p.Send(context.Background(), msg)
+			return err
+		},
+	}
+}
+
+// exhausted checks if the message has reached the max delivery attempts
+func (d *deadLetter) exhausted(msg pulsar.Message) bool {
+	return msg.RedeliveryCount()+1 >= d.maxDeliveries
 }
 
-// ConsumeLoop consumes data from Pulsar topic
+// send publishes the original message to the dead-letter topic with the failure details as properties
+func (d *deadLetter) send(msg pulsar.Message, code int, body string) error {
+	prop := make(map[string]string)
+	for k, v := range msg.Properties() {
+		prop[k] = v
+	}
+	prop["PulsarBeamFailureStatus"] = strconv.Itoa(code)
+	prop["PulsarBeamFailureResponse"] = body
+	prop["PulsarBeamDeliveryAttempts"] = strconv.FormatUint(uint64(msg.RedeliveryCount()+1), 10)
+	prop["PulsarBeamOriginalTopic"] = msg.Topic()
+	prop["PulsarBeamOriginalMessageId"] = fmt.Sprintf("%+v", msg.ID())
+
+	return d.publish(&pulsar.ProducerMessage{
+		Payload:    msg.Payload(),
+		Key:        msg.Key(),
+		EventTime:  msg.EventTime(),
+		Properties: prop,
+	})
+}
+
+// ConsumeLoop consumes data from Pulsar topic, the payload is decoded to JSON if the topic has a schema
 // Do not use context since go vet will puke that requires cancel invoked in the same function
-func (wb *WebhookBroker) ConsumeLoop(url, token, topic, subscriptionKey string, whCfg model.WebhookConfig) error {
-	headers := whCfg.Headers
-	_, err := model.GetSubscriptionType(whCfg.SubscriptionType)
+func (wb *WebhookBroker) ConsumeLoop(url, token, topic, subscriptionKey string, whCfg model.WebhookConfig, schema *model.TopicSchema) error {
+	subType, err := model.GetSubscriptionType(whCfg.SubscriptionType)
 	if err != nil {
 		return err
 	}
@@ -178,15 +507,26 @@ func (wb *WebhookBroker) ConsumeLoop(url, token, topic, subscriptionKey string,
 	if err != nil {
 		return err
 	}
+	delivery, err := newWebhookDelivery(url, token, topic, subscriptionKey, whCfg, schema)
+	if err != nil {
+		return err
+	}
+	topicKey := model.GenKey(topic, url)
 	c, err := pulsardriver.GetPulsarConsumer(url, token, topic, whCfg.Subscription, whCfg.InitialPosition, whCfg.SubscriptionType, subscriptionKey)
 	if err != nil {
 		return fmt.Errorf("failed to create Pulsar subscription %v", err)
 	}
 
+	var workers *deliveryWorkers
+	if n := model.GetConcurrency(whCfg); n > 1 {
+		workers = newDeliveryWorkers(n, subType == pulsar.KeyShared, delivery.push)
+		defer workers.stop()
+	}
+
 	terminate := make(chan *SubCloseSignal, 2)
 	wb.WriteWebhook(subscriptionKey, terminate)
 	defer close(terminate)
-	ctx := context.Background()
+	ctx := wb.ctx
 
 	// infinite loop to receive messages
 	// TODO receive can starve stop channel if it waits for the next message indefinitely
@@ -197,8 +537,18 @@ func (wb *WebhookBroker) ConsumeLoop(url, token, topic, subscriptionKey string,
 			wb.cancelConsumer(subscriptionKey)
 			return fmt.Errorf("consumer retried %d times, max reached", retryMax)
 		}
-		msg, err := c.Receive(ctx)
-		if err != nil {
+		recvCtx, cancel := delivery.receiveContext(ctx)
+		msg, err := c.Receive(recvCtx)
+		cancel()
+		if err != nil && ctx.Err() != nil {
+			// the broker is shutting down
+			delivery.flushBatch(c)
+			wb.l.Infof("subscription %s exits consumer loop on shutdown", subscriptionKey)
+			return nil
+		} else if err != nil && recvCtx.Err() == context.DeadlineExceeded {
+			// the linger time of the pending batch is up
+			delivery.flushBatch(c)
+		} else if err != nil {
 			wb.l.Infof("error from consumer loop receive: %v\n", err)
 			retry++
 			ticker := time.NewTicker(time.Duration(2*retry) * time.Second)
@@ -207,6 +557,8 @@ func (wb *WebhookBroker) ConsumeLoop(url, token, topic, subscriptionKey string,
 			case <-terminate:
 				wb.l.Infof("subscription %s received signal to exit consumer loop", subscriptionKey)
 				return nil
+			case <-ctx.Done():
+				return nil
 			case <-ticker.C:
 				//reconnect after error
 				c, err = pulsardriver.GetPulsarConsumer(url, token, topic, whCfg.Subscription, whCfg.InitialPosition, whCfg.SubscriptionType, subscriptionKey)
@@ -219,28 +571,38 @@ func (wb *WebhookBroker) ConsumeLoop(url, token, topic, subscriptionKey string,
 			if wb.l.Level == log.DebugLevel {
 				wb.l.Debugf("PulsarMessageId:%v", msg.ID())
 			}
-			headers = append(headers, fmt.Sprintf("PulsarMessageId:%#v", msg.ID()))
-			headers = append(headers, "PulsarPublishedTime:"+msg.PublishTime().String())
-			headers = append(headers, "PulsarTopic:"+msg.Topic())
-			nilTime := time.Time{}
-			if msg.EventTime() != nilTime {
-				headers = append(headers, "PulsarEventTime:"+msg.EventTime().String())
-			}
-			for k, v := range msg.Properties() {
-				headers = append(headers, "PulsarProperties-"+k+":"+v)
+			if delivery.filtered(msg) {
+				c.Ack(msg)
+			} else if delivery.batch != nil {
+				delivery.addToBatch(c, msg)
+			} else if workers != nil {
+				workers.dispatch(c, msg)
+			} else {
+				delivery.push(c, msg)
 			}
+		}
 
-			data := msg.Payload()
-			if json.Valid(data) {
-				headers = append(headers, "content-type:application/json")
+		if wb.shouldSuspend(delivery.stats) {
+			if err := wb.suspendWebhook(topicKey, whCfg, delivery); err != nil {
+				wb.l.Errorf("failed to suspend webhook %s error %v", subscriptionKey, err)
+				continue
+			}
+			if workers != nil {
+				// let in flight deliveries finish before the consumer is closed
+				workers.stop()
 			}
-			pushAndAck(c, msg, whCfg.URL, data, headers)
+			wb.closeConsumer(subscriptionKey)
+			return nil
 		}
 	}
 
 }
 
 func (wb *WebhookBroker) run() {
+	if wb.ctx.Err() != nil {
+		// no webhook is started once the broker is shutting down
+		return
+	}
 	// key is hash of topic name and pulsar url, and subscription name
 	subscriptionSet := make(map[string]bool)
 
@@ -249,27 +611,50 @@ func (wb *WebhookBroker) run() {
 			topic := cfg.TopicFullName
 			token := cfg.Token
 			url := cfg.PulsarURL
-			subscriptionKey := cfg.Key + whCfg.URL
+			subscriptionKey := SubscriptionKey(cfg.Key, whCfg)
 			status := whCfg.WebhookStatus
 			_, ok := wb.ReadWebhook(subscriptionKey)
 			if status == model.Activated {
 				subscriptionSet[subscriptionKey] = true
 				if !ok {
 					wb.l.Infof("start activated webhook for topic subscription %v", subscriptionKey)
-					go wb.ConsumeLoop(url, token, topic, subscriptionKey, whCfg)
+					wb.consumers.Add(1)
+					go func(url, token, topic, subscriptionKey string, whCfg model.WebhookConfig, schema *model.TopicSchema) {
+						defer wb.consumers.Done()
+						wb.ConsumeLoop(url, token, topic, subscriptionKey, whCfg, schema)
+					}(url, token, topic, subscriptionKey, whCfg, cfg.Schema)
+				}
+			} else if status == model.Suspended {
+				// a suspended webhook keeps its subscription so that no message is lost, its consumer is closed
+				// by the consumer loop that suspends it, or here if it is suspended by another broker
+				subscriptionSet[subscriptionKey] = true
+				if ok {
+					wb.closeConsumer(subscriptionKey)
+				}
+				// resume probing a webhook suspended before this broker started or by another broker,
+				// a webhook already being probed keeps its probe loop and delivery
+				if wb.suspendAfter > 0 && wb.startProbing(subscriptionKey) {
+					delivery, err := newWebhookDelivery(url, token, topic, subscriptionKey, whCfg, cfg.Schema)
+					if err != nil {
+						wb.stopProbing(subscriptionKey)
+						wb.l.Errorf("failed to probe suspended webhook %s error %v", subscriptionKey, err)
+					} else {
+						go wb.probeLoop(cfg.Key, whCfg, delivery)
+					}
 				}
 			}
 		}
 	}
 
 	// cancel any webhook which is no longer required to be activated by the database
-	for k := range wb.webhooks {
+	for _, k := range wb.webhookKeys() {
 		if !subscriptionSet[k] {
 			wb.l.Infof("cancel webhook consumer subscription key %s", k)
 			wb.cancelConsumer(k)
+			deleteDeliveryStats(k)
 		}
 	}
-	wb.l.Infof("load webhooks size %d", len(wb.webhooks))
+	wb.l.Infof("load webhooks size %d", len(wb.webhookKeys()))
 }
 
 // LoadConfig loads the entire topic documents from the database
@@ -282,6 +667,14 @@ func (wb *WebhookBroker) LoadConfig() []*model.TopicConfig {
 	return cfgs
 }
 
+// closeConsumer stops a webhook consumer and keeps its subscription
+func (wb *WebhookBroker) closeConsumer(key string) {
+	if wb.DeleteWebhook(key) {
+		wb.l.Infof("close consumer %v", key)
+		pulsardriver.ClosePulsarConsumer(key)
+	}
+}
+
 func (wb *WebhookBroker) cancelConsumer(key string) error {
 	ok := wb.DeleteWebhook(key)
 	if ok {
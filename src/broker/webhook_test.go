@@ -0,0 +1,162 @@
+package broker
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/kafkaesque-io/pulsar-beam/src/icrypto"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookDeadLetter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("endpoint is down"))
+	}))
+	defer server.Close()
+
+	whCfg := model.NewWebhookConfig(server.URL)
+	whCfg.RetryPolicy = &model.RetryPolicy{MaxRetries: 0}
+	whCfg.DeadLetterPolicy = model.DeadLetterPolicy{MaxDeliveries: 3}
+	subscriptionKey := "dead-letter-test"
+	defer deleteDeliveryStats(subscriptionKey)
+	delivery, err := newWebhookDelivery("pulsar://localhost:6650", "token", "persistent://ten/ns/topic", subscriptionKey, whCfg, nil)
+	assert.Nil(t, err)
+	var published []*pulsar.ProducerMessage
+	var publishErr error
+	delivery.dlq.publish = func(msg *pulsar.ProducerMessage) error {
+		if publishErr == nil {
+			published = append(published, msg)
+		}
+		return publishErr
+	}
+
+	// a failed message is redelivered before it reaches the max deliveries
+	consumer := &mockConsumer{}
+	msg := &mockMessage{key: "k", payload: []byte("1"), properties: map[string]string{"p": "v"}, redeliveryCount: 1}
+	delivery.push(consumer, msg)
+	acked, nacked := consumer.settled()
+	assert.Empty(t, acked)
+	assert.Equal(t, []pulsar.Message{msg}, nacked)
+	assert.Empty(t, published)
+
+	// the message is routed to the dead-letter topic and acked at the last delivery attempt
+	consumer = &mockConsumer{}
+	msg = &mockMessage{key: "k", payload: []byte("2"), properties: map[string]string{"p": "v"}, redeliveryCount: 2}
+	delivery.push(consumer, msg)
+	acked, nacked = consumer.settled()
+	assert.Equal(t, []pulsar.Message{msg}, acked)
+	assert.Empty(t, nacked)
+	assert.Equal(t, 1, len(published))
+	assert.Equal(t, []byte("2"), published[0].Payload)
+	assert.Equal(t, "k", published[0].Key)
+	props := published[0].Properties
+	assert.NotEmpty(t, props["PulsarBeamOriginalMessageId"])
+	delete(props, "PulsarBeamOriginalMessageId")
+	assert.Equal(t, map[string]string{
+		"p":                          "v",
+		"PulsarBeamFailureStatus":    "500",
+		"PulsarBeamFailureResponse":  "endpoint is down",
+		"PulsarBeamDeliveryAttempts": "3",
+		"PulsarBeamOriginalTopic":    "persistent://ten/ns/topic",
+	}, props)
+
+	// the message is redelivered if it fails to be sent to the dead-letter topic
+	publishErr = errors.New("dead-letter topic is unavailable")
+	consumer = &mockConsumer{}
+	delivery.push(consumer, msg)
+	acked, nacked = consumer.settled()
+	assert.Empty(t, acked)
+	assert.Equal(t, []pulsar.Message{msg}, nacked)
+}
+
+func TestWebhookFailureWithoutDeadLetter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	whCfg := model.NewWebhookConfig(server.URL)
+	whCfg.RetryPolicy = &model.RetryPolicy{MaxRetries: 0}
+	subscriptionKey := "no-dead-letter-test"
+	defer deleteDeliveryStats(subscriptionKey)
+	delivery, err := newWebhookDelivery("pulsar://localhost:6650", "token", "persistent://ten/ns/topic", subscriptionKey, whCfg, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, delivery.dlq)
+
+	consumer := &mockConsumer{}
+	msg := &mockMessage{payload: []byte("1"), redeliveryCount: 10}
+	delivery.push(consumer, msg)
+	acked, nacked := consumer.settled()
+	assert.Empty(t, acked)
+	assert.Equal(t, []pulsar.Message{msg}, nacked)
+}
+
+func TestWebhookResponseDrained(t *testing.T) {
+	var conns int32
+	// retryablehttp closes the idle connections once the retries of a retryable status are exhausted,
+	// so the failure is a non retryable status
+	codes := []int{http.StatusOK, http.StatusUnprocessableEntity, http.StatusBadRequest, http.StatusOK}
+	var requests int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := atomic.AddInt32(&requests, 1) - 1
+		w.WriteHeader(codes[int(i)%len(codes)])
+		// a body larger than the response snippet
+		w.Write([]byte(strings.Repeat("x", 4*responseSnippetSize)))
+	}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	whCfg := model.NewWebhookConfig(server.URL)
+	whCfg.RetryPolicy = &model.RetryPolicy{MaxRetries: 0}
+	subscriptionKey := "drain-test"
+	defer deleteDeliveryStats(subscriptionKey)
+	delivery, err := newWebhookDelivery("pulsar://localhost:6650", "token", "persistent://ten/ns/topic", subscriptionKey, whCfg, nil)
+	assert.Nil(t, err)
+
+	// every reply body is drained and closed, so that the requests share one pooled connection
+	consumer := &mockConsumer{}
+	for range codes {
+		delivery.push(consumer, &mockMessage{payload: []byte("1")})
+	}
+	delivery.pushBatch(consumer, []pulsar.Message{&mockMessage{payload: []byte("2")}})
+	assert.Equal(t, int32(len(codes)+1), atomic.LoadInt32(&requests))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns))
+}
+
+func TestWebhookSignature(t *testing.T) {
+	secret := []byte("a-long-enough-signing-secret")
+	verified := make(chan error, 1)
+	var signedID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		signedID = r.Header.Get(icrypto.WebhookMessageIDHeader)
+		verified <- icrypto.VerifyWebhookRequest(secret, r.Header, body, icrypto.DefaultSignatureTolerance)
+	}))
+	defer server.Close()
+
+	whCfg := model.NewWebhookConfig(server.URL)
+	subscriptionKey := "signature-test"
+	defer deleteDeliveryStats(subscriptionKey)
+	delivery, err := newWebhookDelivery("pulsar://localhost:6650", "token", "persistent://ten/ns/topic", subscriptionKey, whCfg, nil)
+	assert.Nil(t, err)
+	delivery.secret = secret
+
+	delivery.push(&mockConsumer{}, &mockMessage{payload: []byte(`{"a":1}`)})
+	assert.Nil(t, <-verified)
+	// the signed message id is the base64 encoded message id
+	assert.Equal(t, model.MessageIDString(pulsar.EarliestMessageID()), signedID)
+}
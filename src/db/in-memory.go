@@ -2,6 +2,7 @@ package db
 
 import (
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/kafkaesque-io/pulsar-beam/src/model"
@@ -16,15 +17,19 @@ import (
  */
 
 // InMemoryHandler is the in memory cache driver
+// It is accessed by the webhook broker and the probe loops concurrently.
 type InMemoryHandler struct {
 	topics map[string]model.TopicConfig
+	stats  map[string]model.WebhookDeliveryStats
 	logger *log.Entry
+	sync.RWMutex
 }
 
 //Init is a Db interface method.
 func (s *InMemoryHandler) Init() error {
 	s.logger = log.WithFields(log.Fields{"app": "inmemory-db"})
 	s.topics = make(map[string]model.TopicConfig)
+	s.stats = make(map[string]model.WebhookDeliveryStats)
 	return nil
 }
 
@@ -52,6 +57,12 @@ func NewInMemoryHandler() (*InMemoryHandler, error) {
 
 // Create creates a new document
 func (s *InMemoryHandler) Create(topicCfg *model.TopicConfig) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.create(topicCfg)
+}
+
+func (s *InMemoryHandler) create(topicCfg *model.TopicConfig) (string, error) {
 	key, err := getKey(topicCfg)
 	if err != nil {
 		return key, err
@@ -65,10 +76,16 @@ func (s *InMemoryHandler) Create(topicCfg *model.TopicConfig) (string, error) {
 	topicCfg.CreatedAt = time.Now()
 	topicCfg.UpdatedAt = topicCfg.CreatedAt
 
-	s.topics[topicCfg.Key] = *topicCfg
+	s.topics[topicCfg.Key] = copyTopic(*topicCfg)
 	return key, nil
 }
 
+// copyTopic copies the webhooks so that a document returned to the caller does not share them with the store
+func copyTopic(topic model.TopicConfig) model.TopicConfig {
+	topic.Webhooks = append([]model.WebhookConfig{}, topic.Webhooks...)
+	return topic
+}
+
 // GetByTopic gets a document by the topic name and pulsar URL
 func (s *InMemoryHandler) GetByTopic(topicFullName, pulsarURL string) (*model.TopicConfig, error) {
 	key, err := model.GetKeyFromNames(topicFullName, pulsarURL)
@@ -80,7 +97,10 @@ func (s *InMemoryHandler) GetByTopic(topicFullName, pulsarURL string) (*model.To
 
 // GetByKey gets a document by the key
 func (s *InMemoryHandler) GetByKey(hashedTopicKey string) (*model.TopicConfig, error) {
+	s.RLock()
+	defer s.RUnlock()
 	if v, ok := s.topics[hashedTopicKey]; ok {
+		v = copyTopic(v)
 		return &v, nil
 	}
 	return &model.TopicConfig{}, errors.New(DocNotFound)
@@ -88,8 +108,11 @@ func (s *InMemoryHandler) GetByKey(hashedTopicKey string) (*model.TopicConfig, e
 
 // Load loads the entire database as a list
 func (s *InMemoryHandler) Load() ([]*model.TopicConfig, error) {
+	s.RLock()
+	defer s.RUnlock()
 	results := []*model.TopicConfig{}
 	for _, v := range s.topics {
+		v := copyTopic(v)
 		results = append(results, &v)
 	}
 	return results, nil
@@ -102,8 +125,10 @@ func (s *InMemoryHandler) Update(topicCfg *model.TopicConfig) (string, error) {
 		return key, err
 	}
 
+	s.Lock()
+	defer s.Unlock()
 	if _, ok := s.topics[key]; !ok {
-		return s.Create(topicCfg)
+		return s.create(topicCfg)
 	}
 
 	v := s.topics[key]
@@ -115,11 +140,27 @@ func (s *InMemoryHandler) Update(topicCfg *model.TopicConfig) (string, error) {
 	v.Webhooks = topicCfg.Webhooks
 
 	s.logger.Infof("upsert %s", key)
-	s.topics[topicCfg.Key] = *topicCfg
+	s.topics[topicCfg.Key] = copyTopic(*topicCfg)
 	return key, nil
 
 }
 
+// UpdateWebhookStatus sets the status of a webhook if it is in the expected status
+func (s *InMemoryHandler) UpdateWebhookStatus(hashedTopicKey, url string, from, to model.Status, reason string) error {
+	s.Lock()
+	defer s.Unlock()
+	v, ok := s.topics[hashedTopicKey]
+	if !ok {
+		return errors.New(DocNotFound)
+	}
+	doc := copyTopic(v)
+	if err := setWebhookStatus(&doc, url, from, to, reason); err != nil {
+		return err
+	}
+	s.topics[hashedTopicKey] = doc
+	return nil
+}
+
 // Delete deletes a document
 func (s *InMemoryHandler) Delete(topicFullName, pulsarURL string) (string, error) {
 	key, err := model.GetKeyFromNames(topicFullName, pulsarURL)
@@ -131,6 +172,8 @@ func (s *InMemoryHandler) Delete(topicFullName, pulsarURL string) (string, error
 
 // DeleteByKey deletes a document based on key
 func (s *InMemoryHandler) DeleteByKey(hashedTopicKey string) (string, error) {
+	s.Lock()
+	defer s.Unlock()
 	if _, ok := s.topics[hashedTopicKey]; !ok {
 		return "", errors.New(DocNotFound)
 	}
@@ -138,3 +181,21 @@ func (s *InMemoryHandler) DeleteByKey(hashedTopicKey string) (string, error) {
 	delete(s.topics, hashedTopicKey)
 	return hashedTopicKey, nil
 }
+
+// SaveWebhookStats saves the delivery stats of a webhook
+func (s *InMemoryHandler) SaveWebhookStats(subscriptionKey string, stats model.WebhookDeliveryStats) error {
+	s.Lock()
+	defer s.Unlock()
+	s.stats[subscriptionKey] = stats
+	return nil
+}
+
+// GetWebhookStats gets the delivery stats of a webhook
+func (s *InMemoryHandler) GetWebhookStats(subscriptionKey string) (*model.WebhookDeliveryStats, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if v, ok := s.stats[subscriptionKey]; ok {
+		return &v, nil
+	}
+	return nil, errors.New(DocNotFound)
+}
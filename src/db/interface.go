@@ -2,6 +2,8 @@ package db
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/kafkaesque-io/pulsar-beam/src/model"
 
@@ -22,6 +24,15 @@ type Crud interface {
 
 	// Load is invoked by the webhook.go to start new wekbooks and stop deleted ones
 	Load() ([]*model.TopicConfig, error)
+
+	// SaveWebhookStats and GetWebhookStats keep the delivery stats of a webhook by its subscription key,
+	// so that the stats written by the webhook broker can be served by the REST API of any process
+	SaveWebhookStats(subscriptionKey string, stats model.WebhookDeliveryStats) error
+	GetWebhookStats(subscriptionKey string) (*model.WebhookDeliveryStats, error)
+
+	// UpdateWebhookStatus sets the status of a webhook only if it is in the expected status,
+	// without overwriting the other fields of the topic document updated concurrently
+	UpdateWebhookStatus(hashedTopicKey, url string, from, to model.Status, reason string) error
 }
 
 // Ops interface specifies required database access operations
@@ -67,8 +78,35 @@ func NewDbWithPanic(reqDbType string) Db {
 	return newDb
 }
 
+// CloseDb closes the database singleton if it has been created
+func CloseDb() error {
+	if dbConn == nil {
+		return nil
+	}
+	err := dbConn.Close()
+	dbConn = nil
+	return err
+}
+
 // DocNotFound means no document found in the database
 var DocNotFound = "no document found"
 
+// setWebhookStatus transitions the status of the webhook in the topic document if it is in the expected status
+func setWebhookStatus(doc *model.TopicConfig, url string, from, to model.Status, reason string) error {
+	for i, wh := range doc.Webhooks {
+		if wh.URL != url {
+			continue
+		}
+		if wh.WebhookStatus != from {
+			return fmt.Errorf("webhook %s status %d is not in the expected status %d", url, wh.WebhookStatus, from)
+		}
+		doc.Webhooks[i].WebhookStatus = to
+		doc.Webhooks[i].StatusReason = reason
+		doc.Webhooks[i].UpdatedAt = time.Now()
+		return nil
+	}
+	return fmt.Errorf("webhook %s does not exist in topic %s", url, doc.Key)
+}
+
 // DocAlreadyExisted means document already existed in the database when a new creation is requested
 var DocAlreadyExisted = "document already existed"
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/kafkaesque-io/pulsar-beam/src/model"
@@ -20,12 +21,14 @@ import (
 type MongoDb struct {
 	client     *mongo.Client
 	collection *mongo.Collection
+	stats      *mongo.Collection
 	logger     *log.Entry
 }
 
 var connectionString string = "mongodb://localhost:27017"
 var dbName string = "localhost"
 var collectionName string = "topics"
+var statsCollectionName string = "webhookstats"
 
 //Init is a Db interface method.
 func (s *MongoDb) Init() error {
@@ -62,6 +65,16 @@ func (s *MongoDb) Init() error {
 		return err
 	}
 
+	s.stats = s.client.Database(dbName).Collection(statsCollectionName)
+	_, err = s.stats.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.M{"key": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		s.logger.Errorf("database stats index creation failed %s", err.Error())
+		return err
+	}
+
 	s.logger.Infof("mongo database name %v, collection %v", dbName, collectionName)
 	return nil
 }
@@ -243,6 +256,61 @@ func (s *MongoDb) DeleteByKey(hashedTopicKey string) (string, error) {
 	return hashedTopicKey, nil
 }
 
+// webhookStatsDoc is the document of the webhook delivery stats collection
+type webhookStatsDoc struct {
+	Key   string                     `bson:"key"`
+	Stats model.WebhookDeliveryStats `bson:"stats"`
+}
+
+// UpdateWebhookStatus sets the status of a webhook if it is in the expected status
+// The document is matched by the webhook url and status, so the check and update are atomic.
+func (s *MongoDb) UpdateWebhookStatus(hashedTopicKey, url string, from, to model.Status, reason string) error {
+	filter := bson.M{
+		"key": hashedTopicKey,
+		"webhooks": bson.M{
+			"$elemMatch": bson.M{"url": url, "webhookstatus": from},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"webhooks.$.webhookstatus": to,
+			"webhooks.$.statusreason":  reason,
+			"webhooks.$.updatedat":     time.Now(),
+		},
+	}
+	result, err := s.collection.UpdateOne(context.TODO(), filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("webhook %s of topic %s does not exist or is not in the expected status %d", url, hashedTopicKey, from)
+	}
+	return nil
+}
+
+// SaveWebhookStats upserts the delivery stats of a webhook
+func (s *MongoDb) SaveWebhookStats(subscriptionKey string, stats model.WebhookDeliveryStats) error {
+	_, err := s.stats.UpdateOne(
+		context.TODO(),
+		bson.M{"key": subscriptionKey},
+		bson.M{"$set": webhookStatsDoc{Key: subscriptionKey, Stats: stats}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// GetWebhookStats gets the delivery stats of a webhook
+func (s *MongoDb) GetWebhookStats(subscriptionKey string) (*model.WebhookDeliveryStats, error) {
+	var doc webhookStatsDoc
+	if err := s.stats.FindOne(context.TODO(), bson.M{"key": subscriptionKey}).Decode(&doc); err != nil {
+		if err == mongo.ErrNoDocuments {
+			err = errors.New(DocNotFound)
+		}
+		return nil, err
+	}
+	return &doc.Stats, nil
+}
+
 func exists(key string, coll *mongo.Collection) (bool, error) {
 	var doc model.TopicConfig
 	result := coll.FindOne(context.TODO(), bson.M{"key": key})
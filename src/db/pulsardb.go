@@ -40,13 +40,22 @@ type PulsarHandler struct {
 	client      pulsar.Client
 	producer    pulsar.Producer
 	topics      map[string]model.TopicConfig
+	statsLock   sync.RWMutex
+	stats       map[string]model.WebhookDeliveryStats
 	logger      *log.Entry
 }
 
+// the message property to tell a webhook stats document from a topic config document in the database topic
+const (
+	docTypeProperty  = "docType"
+	webhookStatsType = "webhookStats"
+)
+
 //Init is a Db interface method.
 func (s *PulsarHandler) Init() error {
 	s.logger = log.WithFields(log.Fields{"app": "pulsardb"})
 	s.topics = make(map[string]model.TopicConfig)
+	s.stats = make(map[string]model.WebhookDeliveryStats)
 
 	s.logger.Infof("database pulsar URL: %s", s.PulsarURL)
 	if log.GetLevel() == log.DebugLevel {
@@ -109,19 +118,30 @@ func (s *PulsarHandler) dbListener(sig chan *liveSignal) error {
 			log.Errorf("dbListener reader.Next() error %v", err)
 			return err
 		}
+		if data.Properties()[docTypeProperty] == webhookStatsType {
+			stats := model.WebhookDeliveryStats{}
+			if err = json.Unmarshal(data.Payload(), &stats); err != nil {
+				s.logger.Errorf("dblistener reader unmarshal webhook stats error %v", err)
+				continue
+			}
+			s.statsLock.Lock()
+			s.stats[strings.TrimPrefix(data.Key(), webhookStatsType+"-")] = stats
+			s.statsLock.Unlock()
+			continue
+		}
 		doc := model.TopicConfig{}
 		if err = json.Unmarshal(data.Payload(), &doc); err != nil {
 			s.logger.Errorf("dblistener reader unmarshal error %v", err)
 			// ignore error and move on
 		} else {
 			s.topicsLock.Lock()
-			defer s.topicsLock.Unlock()
 			if doc.TopicStatus != model.Deleted {
 				s.logger.Infof("add topic configuration %s", doc.Key)
 				s.topics[doc.Key] = doc
 			} else {
 				delete(s.topics, doc.Key)
 			}
+			s.topicsLock.Unlock()
 		}
 	}
 }
@@ -259,6 +279,23 @@ func (s *PulsarHandler) Update(topicCfg *model.TopicConfig) (string, error) {
 
 }
 
+// UpdateWebhookStatus sets the status of a webhook if it is in the expected status
+// The check and update are atomic in this process only, since the database topic has no conditional write.
+func (s *PulsarHandler) UpdateWebhookStatus(hashedTopicKey, url string, from, to model.Status, reason string) error {
+	s.topicsLock.Lock()
+	defer s.topicsLock.Unlock()
+	v, ok := s.topics[hashedTopicKey]
+	if !ok {
+		return errors.New(DocNotFound)
+	}
+	v.Webhooks = append([]model.WebhookConfig{}, v.Webhooks...)
+	if err := setWebhookStatus(&v, url, from, to, reason); err != nil {
+		return err
+	}
+	_, err := s.updateCacheAndPulsar(&v)
+	return err
+}
+
 // Delete deletes a document
 func (s *PulsarHandler) Delete(topicFullName, pulsarURL string) (string, error) {
 	key, err := model.GetKeyFromNames(topicFullName, pulsarURL)
@@ -295,3 +332,35 @@ func (s *PulsarHandler) DeleteByKey(hashedTopicKey string) (string, error) {
 	delete(s.topics, v.Key)
 	return hashedTopicKey, nil
 }
+
+// SaveWebhookStats sends the delivery stats of a webhook to the database topic
+// The stats document key is prefixed so that it is compacted separately from the topic config documents.
+func (s *PulsarHandler) SaveWebhookStats(subscriptionKey string, stats model.WebhookDeliveryStats) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	msg := pulsar.ProducerMessage{
+		Payload:    data,
+		Key:        webhookStatsType + "-" + subscriptionKey,
+		Properties: map[string]string{docTypeProperty: webhookStatsType},
+	}
+	if _, err = s.producer.Send(context.Background(), &msg); err != nil {
+		return err
+	}
+
+	s.statsLock.Lock()
+	defer s.statsLock.Unlock()
+	s.stats[subscriptionKey] = stats
+	return nil
+}
+
+// GetWebhookStats gets the delivery stats of a webhook
+func (s *PulsarHandler) GetWebhookStats(subscriptionKey string) (*model.WebhookDeliveryStats, error) {
+	s.statsLock.RLock()
+	defer s.statsLock.RUnlock()
+	if v, ok := s.stats[subscriptionKey]; ok {
+		return &v, nil
+	}
+	return nil, errors.New(DocNotFound)
+}
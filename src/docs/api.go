@@ -11,9 +11,47 @@ import (
 //
 // ---
 // headers:
+// parameters:
+// - name: PulsarKey
+//   in: header
+//   description: the message key, or the query parameter key
+//   type: string
+//   required: false
+// - name: PulsarOrderingKey
+//   in: header
+//   description: the message ordering key, or the query parameter orderingKey
+//   type: string
+//   required: false
+// - name: PulsarEventTime
+//   in: header
+//   description: the event time in RFC 3339 format or unix epoch milliseconds, or the query parameter eventTime
+//   type: string
+//   required: false
+// - name: PulsarDeliverAfter
+//   in: header
+//   description: delay the delivery by a duration such as 30s or milliseconds, or the query parameter deliverAfter
+//   type: string
+//   required: false
+// - name: PulsarDeliverAt
+//   in: header
+//   description: delay the delivery until a time in RFC 3339 format or unix epoch milliseconds, or the query parameter deliverAt
+//   type: string
+//   required: false
+// - name: property
+//   in: query
+//   description: a message property in the format of name:value, it can be repeated. The header PulsarProperty sets a property in the same format.
+//   type: string
+//   required: false
+// - name: Idempotency-Key
+//   in: header
+//   description: a key to retry the request safely, the response of a repeated key is replayed with the header Idempotent-Replayed. It is not supported in async mode.
+//   type: string
+//   required: false
 // responses:
 //   '200':
 //     description: successfully sent messages
+//     schema:
+//       "$ref": "#/definitions/firehoseResponse"
 //   '401':
 //     description: authentication failure
 //     schema:
@@ -31,6 +69,50 @@ import (
 //     schema:
 //       "$ref": "#/definitions/errorResponse"
 
+// swagger:operation POST /v2/firehose/batch/{persistent}/{tenant}/{namespace}/{topic} Send-Batch-Messages idOfFirehoseBatchEndpoint
+//
+// The endpoint receives a batch of messages in HTTP body, either a JSON array or newline delimited JSON, that will be sent to Pulsar.
+// Every message has a JSON payload in `payload` or a base64 encoded payload in `payloadBase64`, and optional `key`, `properties`, and `eventTime`.
+//
+// ---
+// headers:
+// responses:
+//   '200':
+//     description: successfully sent all messages
+//     schema:
+//       "$ref": "#/definitions/firehoseBatchResponse"
+//   '207':
+//     description: some messages failed to be sent to Pulsar
+//     schema:
+//       "$ref": "#/definitions/firehoseBatchResponse"
+//   '401':
+//     description: authentication failure
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+//   '422':
+//     description: invalid request parameters or messages
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+//   '500':
+//     description: failed to read the http body
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+//   '503':
+//     description: failed to send messages to Pulsar
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+
+// swagger:route GET /v2/firehose/status/{pulsarBeamId} Async-Send-Status idOfAsyncSendStatus
+// Get the outcome of a message sent in async mode by its PulsarBeamId.
+// The status is kept in the receiver process that accepted the message for an hour.
+//
+// headers:
+// responses:
+//   200: asyncSendStatusResponse
+//   401: errorResponse
+//   403:
+//   404: errorResponse
+
 // swagger:operation GET /v2/sse/{persistent}/{tenant}/{namespace}/{topic} SSE-Event-Streaming idOfHTTPSeverSentEvent
 // The HTTP SSE endpoint receives messages in HTTP body from a Pulsar topic.
 //
@@ -57,6 +139,31 @@ import (
 //   description: subscription name in minimum 5 charaters, a random subscription will be generated if not specified
 //   type: string
 //   required: false
+// - name: Last-Event-ID
+//   in: header
+//   description: resume the stream after the event id, or the query parameter lastEventId
+//   type: string
+//   required: false
+// - name: format
+//   in: query
+//   description: raw as default sends the payload, envelope sends a JSON envelope of the message with its metadata
+//   type: string
+//   required: false
+// - name: payloadEncoding
+//   in: query
+//   description: the payload encoding in the envelope, base64 as default or utf8
+//   type: string
+//   required: false
+// - name: event
+//   in: query
+//   description: sets the event name to the message key with key, or a message property with property:<name>
+//   type: string
+//   required: false
+// - name: filter
+//   in: query
+//   description: a filter expression on the key, properties, and JSON payload fields to stream only the matching messages
+//   type: string
+//   required: false
 // responses:
 //   '401':
 //     description: authentication failure
@@ -71,6 +178,56 @@ import (
 //     schema:
 //       "$ref": "#/definitions/errorResponse"
 
+// swagger:operation GET /v2/ws/{persistent}/{tenant}/{namespace}/{topic} WebSocket-Streaming idOfWebSocket
+// The WebSocket endpoint streams messages from a Pulsar topic as JSON frames. A client acks or nacks a message by its message id,
+// grants permits to receive more messages with a flow frame, and publishes messages to the topic with a publish frame.
+//
+// ---
+// headers:
+// - name: PulsarURL
+//   description: Specify a pulsar cluster. This can be ignored by the server side to enforce connecting to a local Pulsar cluster.
+//   required: false
+// parameters:
+// - name: SubscriptionInitialPosition
+//   in: query
+//   description: specify subscription initial position in either latest or earliest, the default is latest
+//   type: string
+//   required: false
+// - name: SubscriptionType
+//   in: query
+//   description: specify subscription type in exclusive, shared, keyshared, or failover, the default is exclusive
+//   type: string
+//   required: false
+// - name: SubscriptionName
+//   in: query
+//   description: subscription name in minimum 5 charaters, a random subscription will be generated if not specified
+//   type: string
+//   required: false
+// - name: permits
+//   in: query
+//   description: the number of messages that can be delivered before the client grants more permits, the default is 100 and the max is 10000
+//   type: integer
+//   required: false
+// responses:
+//   '101':
+//     description: switching to the WebSocket protocol
+//   '400':
+//     description: the request is not a WebSocket upgrade
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+//   '401':
+//     description: authentication failure
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+//   '422':
+//     description: invalid request parameters
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+//   '500':
+//     description: failed to subscribe to the Pulsar topic
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+
 // swagger:operation GET /v2/poll/{persistent}/{tenant}/{namespace}/{topic} Long-Polling idOfHTTPLongPolling
 // The long polling endpoint receives messages in HTTP body from a Pulsar topic.
 //
@@ -102,6 +259,34 @@ import (
 //   description: Per message time out in milliseconds to wait the message from the Pulsar topic. The default is 300 millisecond
 //   type: integer
 //   required: false
+// - name: waitMs
+//   in: query
+//   description: long poll time in milliseconds to wait for the first message up to 30000, the poll responds as soon as the first message arrives. The default is 0 to disable long poll
+//   type: integer
+//   required: false
+// - name: autoAck
+//   in: query
+//   description: false returns the messages of a durable subscription with receipt handles and keeps them unacknowledged until they are acknowledged. The default is true
+//   type: boolean
+//   required: false
+// - name: visibilityTimeoutMs
+//   in: query
+//   description: the time in milliseconds a message polled with autoAck false is invisible before it is redelivered, up to 12 hours. The default is 30 seconds
+//   type: integer
+//   required: false
+// - name: ack
+//   in: query
+//   description: the receipt handle of a message polled with autoAck false to be acknowledged, it can be repeated
+//   type: array
+//   items:
+//     type: string
+//   collectionFormat: multi
+//   required: false
+// - name: filter
+//   in: query
+//   description: a filter expression on the key, properties, and JSON payload fields to poll only the matching messages
+//   type: string
+//   required: false
 // responses:
 //   '200':
 //     description: successfully subscribed and received messages from a Pulsar topic
@@ -120,6 +305,145 @@ import (
 //     schema:
 //       "$ref": "#/definitions/errorResponse"
 
+// swagger:operation GET /v2/read/{persistent}/{tenant}/{namespace}/{topic} Read-Messages idOfReadMessages
+// The endpoint reads a page of messages from a topic by a reader without creating a subscription.
+//
+// ---
+// produces:
+// - application/json
+// parameters:
+// - name: cursor
+//   in: query
+//   description: the cursor of the previous page to continue after its last message
+//   type: string
+//   required: false
+// - name: startMessageId
+//   in: query
+//   description: the base64 encoded message id to start from, including the message
+//   type: string
+//   required: false
+// - name: startTime
+//   in: query
+//   description: start from the first message published at or after the time in epoch milliseconds or RFC 3339
+//   type: string
+//   required: false
+// - name: batchSize
+//   in: query
+//   description: the max number of messages in a page up to 1000. The default is 10 messages
+//   type: integer
+//   required: false
+// - name: perMessageTimeoutMs
+//   in: query
+//   description: the time in milliseconds to wait for the next message. The default is 300 millisecond
+//   type: integer
+//   required: false
+// responses:
+//   '200':
+//     description: a page of messages with the continuation cursor
+//   '401':
+//     description: authentication failure
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+//   '422':
+//     description: invalid request parameters
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+//   '500':
+//     description: failed to read messages from Pulsar
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+
+// swagger:operation POST /v2/ack/{persistent}/{tenant}/{namespace}/{topic} Ack-Messages idOfAckMessages
+// The endpoint acknowledges the messages polled with autoAck false by their receipt handles.
+//
+// ---
+// parameters:
+// - name: SubscriptionName
+//   in: query
+//   description: the durable subscription name of the poll
+//   type: string
+//   required: true
+// - name: body
+//   in: body
+//   required: true
+//   schema:
+//     "$ref": "#/definitions/ackRequest"
+// responses:
+//   '200':
+//     description: the receipt handles acknowledged and failed, a receipt handle fails if it is unknown or its visibility timeout has expired
+//     schema:
+//       "$ref": "#/definitions/ackResponse"
+//   '401':
+//     description: authentication failure
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+//   '422':
+//     description: invalid request parameters or receipt handles
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+
+// swagger:operation POST /v2/nack/{persistent}/{tenant}/{namespace}/{topic} Nack-Messages idOfNackMessages
+// The endpoint negatively acknowledges the messages polled with autoAck false by their receipt handles, so that they are redelivered without waiting for the visibility timeout.
+//
+// ---
+// parameters:
+// - name: SubscriptionName
+//   in: query
+//   description: the durable subscription name of the poll
+//   type: string
+//   required: true
+// - name: body
+//   in: body
+//   required: true
+//   schema:
+//     "$ref": "#/definitions/ackRequest"
+// responses:
+//   '200':
+//     description: the receipt handles negatively acknowledged and failed, a receipt handle fails if it is unknown or its visibility timeout has expired
+//     schema:
+//       "$ref": "#/definitions/ackResponse"
+//   '401':
+//     description: authentication failure
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+//   '422':
+//     description: invalid request parameters or receipt handles
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+
+// swagger:operation POST /v2/seek/{persistent}/{tenant}/{namespace}/{topic} Seek-Poll-Subscription idOfSeekPollSubscription
+// The endpoint resets a durable poll subscription to the earliest or latest position, a timestamp, or a message id.
+//
+// ---
+// parameters:
+// - name: SubscriptionName
+//   in: query
+//   description: the durable subscription name of the poll
+//   type: string
+//   required: true
+// - name: body
+//   in: body
+//   required: true
+//   schema:
+//     "$ref": "#/definitions/seekRequest"
+// responses:
+//   '204':
+//     description: successfully reset the subscription
+//   '403':
+//     description: the token subject is not authorized for the topic tenant
+//   '409':
+//     description: the exclusive subscription is consumed by another process
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+//   '422':
+//     description: invalid request parameters or seek target
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+//   '500':
+//     description: failed to seek the subscription
+//     schema:
+//       "$ref": "#/definitions/errorResponse"
+
 // swagger:route GET /v2/topic Get-Topic idOfGetTopic
 // Get a topic configuration based on the topic name.
 //
@@ -142,6 +466,31 @@ import (
 //   422: errorResponse
 //   500: errorResponse
 
+// swagger:route GET /v2/topic/{topicKey}/webhooks/status Get-Webhook-Status idOfGetWebhookStatus
+// Get the delivery status of a topic's webhooks based on topic key.
+// The delivery stats are only available when the webhook broker runs in the same process.
+//
+// headers:
+// responses:
+//   200: webhookStatusResponse
+//   403:
+//   404: errorResponse
+//   422: errorResponse
+//   500: errorResponse
+
+// swagger:route POST /v2/topic/{topicKey}/webhooks/seek Seek-Webhook-Subscription idOfSeekWebhook
+// Reset a webhook subscription of a topic to the earliest or latest position, a timestamp, or a message id.
+// A webhook running by the webhook broker in the same process keeps delivering from the new position.
+// An exclusive subscription consumed by a webhook broker in another process cannot be sought and replies 409.
+//
+// responses:
+//   204:
+//   403:
+//   404: errorResponse
+//   409: errorResponse
+//   422: errorResponse
+//   500: errorResponse
+
 // swagger:route POST /v2/topic Create-or-Update-Topic idOfUpdateTopic
 // Create or update a topic configuration.
 // Please do NOT specifiy key. The topic status must be for 1 for activation.
@@ -178,6 +527,43 @@ import (
 type sseQueryParams struct {
 }
 
+// swagger:parameters idOfFirehoseBatchEndpoint
+type firehoseBatchParams struct {
+	// in:body
+	Body []model.FirehoseMessage
+}
+
+// swagger:model firehoseResponse
+type firehoseResponse struct {
+	Body model.FirehoseResponse
+}
+
+// swagger:model firehoseBatchResponse
+type firehoseBatchResponse struct {
+	Body model.FirehoseBatchResponse
+}
+
+// swagger:model ackRequest
+type ackRequest struct {
+	Body model.AckRequest
+}
+
+// swagger:model ackResponse
+type ackResponse struct {
+	Body model.AckResponse
+}
+
+// swagger:model seekRequest
+type seekRequest struct {
+	Body model.SeekRequest
+}
+
+// swagger:parameters idOfSeekWebhook
+type seekWebhookParams struct {
+	// in:body
+	Body model.SeekRequest
+}
+
 // swagger:parameters idOfGetTopic
 type topicGetParams struct {
 	// in:body
@@ -195,6 +581,16 @@ type topicGetResponse struct {
 	Body model.TopicConfig
 }
 
+// swagger:response webhookStatusResponse
+type webhookStatusResponse struct {
+	Body []model.WebhookState
+}
+
+// swagger:response asyncSendStatusResponse
+type asyncSendStatusResponse struct {
+	Body model.AsyncSendStatus
+}
+
 // swagger:response topicDeleteResponse
 type topicDeleteResponse struct {
 	Body model.TopicConfig
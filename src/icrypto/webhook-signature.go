@@ -0,0 +1,80 @@
+package icrypto
+
+// This is the HMAC-SHA256 signature scheme of outbound webhook requests.
+// Beam signs the string `<timestamp>.<message id>.<body>` with the webhook's signing secret
+// and sends these headers along with the request
+//   PulsarBeam-Timestamp: unix time in seconds when the request was signed
+//   PulsarBeam-Signature: v1=<hex encoded HMAC-SHA256>
+//   PulsarBeam-MessageId: the base64 encoded Pulsar message id, the same format as the message id in the REST API,
+//   or empty for a batch request
+// A receiver recomputes the signature over the raw request body and compares it in constant time,
+// and rejects a request whose timestamp is outside of a tolerance window to prevent replay.
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// WebhookTimestampHeader is the header name of the signature timestamp
+	WebhookTimestampHeader = "PulsarBeam-Timestamp"
+	// WebhookSignatureHeader is the header name of the signature
+	WebhookSignatureHeader = "PulsarBeam-Signature"
+	// WebhookMessageIDHeader is the header name of the signed base64 encoded Pulsar message id
+	WebhookMessageIDHeader = "PulsarBeam-MessageId"
+
+	// DefaultSignatureTolerance is the recommended tolerance of the signature timestamp
+	DefaultSignatureTolerance = 5 * time.Minute
+
+	signatureVersion = "v1="
+)
+
+// SignWebhook computes the signature of a webhook request body and message id at the timestamp
+func SignWebhook(secret []byte, timestamp int64, messageID string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write([]byte(messageID))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signatureVersion + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature verifies the signature and the timestamp is within the tolerance
+func VerifyWebhookSignature(secret []byte, timestamp, messageID, signature string, body []byte, tolerance time.Duration) error {
+	ts, err := strconv.ParseInt(strings.TrimSpace(timestamp), 10, 64)
+	if err != nil {
+		return errors.New("invalid webhook signature timestamp")
+	}
+	if tolerance > 0 {
+		diff := time.Since(time.Unix(ts, 0))
+		if diff > tolerance || diff < -tolerance {
+			return errors.New("webhook signature timestamp is out of tolerance")
+		}
+	}
+
+	expected := SignWebhook(secret, ts, messageID, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.TrimSpace(signature))) {
+		return errors.New("webhook signature mismatch")
+	}
+	return nil
+}
+
+// VerifyWebhookRequest verifies the signature headers of a webhook request against its raw body
+// It can be used by a webhook receiver, such as
+//
+//	body, _ := ioutil.ReadAll(r.Body)
+//	err := icrypto.VerifyWebhookRequest(secret, r.Header, body, icrypto.DefaultSignatureTolerance)
+func VerifyWebhookRequest(secret []byte, h http.Header, body []byte, tolerance time.Duration) error {
+	signature := h.Get(WebhookSignatureHeader)
+	if signature == "" {
+		return errors.New("missing webhook signature")
+	}
+	return VerifyWebhookSignature(secret, h.Get(WebhookTimestampHeader), h.Get(WebhookMessageIDHeader), signature, body, tolerance)
+}
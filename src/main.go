@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
+	"time"
 
 	"github.com/google/gops/agent"
 	"github.com/kafkaesque-io/pulsar-beam/src/broker"
+	"github.com/kafkaesque-io/pulsar-beam/src/db"
+	"github.com/kafkaesque-io/pulsar-beam/src/pulsardriver"
 	"github.com/kafkaesque-io/pulsar-beam/src/route"
 	"github.com/kafkaesque-io/pulsar-beam/src/util"
 	"github.com/rs/cors"
@@ -27,7 +35,6 @@ func main() {
 		log.Panicf("gops instrument error %v", err)
 	}
 
-	exit := make(chan bool) // future use to exit the main program if in broker only mode
 	config := util.Init()
 
 	flag.Parse()
@@ -36,16 +43,23 @@ func main() {
 		log.Panic("Unsupported server mode")
 	}
 
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
 	if util.IsBrokerRequired(&mode) {
 		broker.Init(config)
 	}
+
+	// streaming requests, such as SSE, end when the base context is cancelled on shutdown
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	var server *http.Server
 	if util.IsHTTPRouterRequired(&mode) {
 		route.Init()
 
 		c := cors.New(cors.Options{
 			AllowedOrigins:   []string{"http://localhost:8085", "http://localhost:8080"},
 			AllowCredentials: true,
-			AllowedHeaders:   []string{"Authorization", "PulsarTopicUrl"},
+			AllowedHeaders:   []string{"Authorization", "PulsarTopicUrl", "PulsarKey", "PulsarOrderingKey", "PulsarEventTime", "PulsarDeliverAfter", "PulsarDeliverAt", "Idempotency-Key", "Last-Event-ID"},
 		})
 
 		router := route.NewRouter(&mode)
@@ -55,13 +69,50 @@ func main() {
 		port := util.AssignString(config.PORT, "8085")
 		certFile := util.GetConfig().CertFile
 		keyFile := util.GetConfig().KeyFile
-		log.Fatal(util.ListenAndServeTLS(":"+port, certFile, keyFile, handler))
+		server = &http.Server{
+			Addr:        ":" + port,
+			Handler:     handler,
+			BaseContext: func(net.Listener) context.Context { return baseCtx },
+		}
+		go func() {
+			if err := util.ListenAndServeTLS(server, certFile, keyFile); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	sig := <-sigs
+	log.Warnf("received signal %v, shutting down", sig)
+	shutdown(server, cancelRequests)
+}
+
+// shutdown stops accepting HTTP requests, drains in-flight requests and webhook deliveries
+// within the shutdown timeout, then closes Pulsar producers, consumers, and the database
+func shutdown(server *http.Server, cancelRequests context.CancelFunc) {
+	timeoutStr := util.AssignString(util.GetConfig().ShutdownTimeout, "25s")
+	timeout, err := time.ParseDuration(timeoutStr)
+	if err != nil {
+		log.Errorf("specified shutdown timeout %s error %v", timeoutStr, err)
+		timeout = 25 * time.Second
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	for util.IsBroker(&mode) {
-		select {
-		case <-exit:
-			os.Exit(2)
+	if server != nil {
+		cancelRequests()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Errorf("http server shutdown error %v", err)
+		}
+	}
+	if util.IsBrokerRequired(&mode) {
+		if err := broker.Shutdown(ctx); err != nil {
+			log.Errorf("webhook broker shutdown error %v", err)
 		}
 	}
+
+	pulsardriver.Shutdown(ctx)
+	if err := db.CloseDb(); err != nil {
+		log.Errorf("database close error %v", err)
+	}
+	log.Warnf("server shutdown completed")
 }
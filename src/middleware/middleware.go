@@ -2,8 +2,10 @@ package middleware
 
 //middleware includes auth, rate limit, and etc.
 import (
+	"context"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/kafkaesque-io/pulsar-beam/src/util"
 
@@ -11,32 +13,53 @@ import (
 )
 
 var (
-	// Rate is the default global rate limit
-	// This rate only limits the rate hitting on endpoint
-	// It does not limit the underline resource access
-	Rate = NewSema(200)
+	// rateLimiter is the rate limiter of all routes, created from the configuration on first use
+	rateLimiter     *RateLimiter
+	rateLimiterOnce sync.Once
 )
 
 // AuthFunc is a function type to allow pluggable authentication middleware
 type AuthFunc func(next http.Handler) http.Handler
 
+// the request context keys set by the middleware
+type contextKey int
+
+const (
+	subjectsKey contextKey = iota
+	admissionKey
+)
+
+// WithSubjects returns the request with the authenticated JWT subjects in its context
+// A pluggable auth middleware calls it so that the rate limiter is keyed by the subjects.
+func WithSubjects(r *http.Request, subjects string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), subjectsKey, subjects))
+}
+
+// Subjects returns the JWT subjects authenticated by the auth middleware
+func Subjects(r *http.Request) (string, bool) {
+	subjects, ok := r.Context().Value(subjectsKey).(string)
+	return subjects, ok && subjects != ""
+}
+
 // AuthVerifyJWT Authenticate middleware function
 func AuthVerifyJWT(next http.Handler) http.Handler {
 	switch util.GetConfig().HTTPAuthImpl {
 	case "noauth":
+		// the rate limiter is keyed by the client IP address since every request has the super role
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			r.Header.Set("injectedSubs", util.SuperRoles[0])
 			next.ServeHTTP(w, r)
 		})
 	default:
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Del("injectedSubs")
 			tokenStr := strings.TrimSpace(strings.Replace(r.Header.Get("Authorization"), "Bearer", "", 1))
 			subjects, err := util.JWTAuth.GetTokenSubject(tokenStr)
 
 			if err == nil {
 				log.Infof("Authenticated with subjects %s", subjects)
 				r.Header.Set("injectedSubs", subjects)
-				next.ServeHTTP(w, r)
+				next.ServeHTTP(w, WithSubjects(r, subjects))
 			} else {
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			}
@@ -48,6 +71,8 @@ func AuthVerifyJWT(next http.Handler) http.Handler {
 // AuthHeaderRequired is a very weak auth to verify token existence only.
 func AuthHeaderRequired(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the subjects are not verified, so a client cannot inject them either
+		r.Header.Del("injectedSubs")
 		tokenStr := strings.TrimSpace(strings.Replace(r.Header.Get("Authorization"), "Bearer", "", 1))
 
 		if len(tokenStr) > 1 {
@@ -62,20 +87,26 @@ func AuthHeaderRequired(next http.Handler) http.Handler {
 // NoAuth bypasses the auth middleware
 func NoAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("injectedSubs")
 		next.ServeHTTP(w, r)
 	})
 }
 
-// LimitRate rate limites against http handler
-// use semaphore as a simple rate limiter
-func LimitRate(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		err := Rate.Acquire()
-		if err != nil {
-			http.Error(w, "Too many requests", http.StatusTooManyRequests)
-		} else {
-			next.ServeHTTP(w, r)
-		}
-		Rate.Release()
+// LimitRate rate limits requests on the route per tenant
+// It must be wrapped by the auth middleware that injects the tenant's JWT subjects.
+func LimitRate(route string) func(next http.Handler) http.Handler {
+	return getRateLimiter().Limit(route)
+}
+
+// LimitAuthFailures rate limits requests failing authentication on the route per client IP address
+// It must wrap the auth middleware.
+func LimitAuthFailures(route string) func(next http.Handler) http.Handler {
+	return getRateLimiter().LimitAuthFailures(route)
+}
+
+func getRateLimiter() *RateLimiter {
+	rateLimiterOnce.Do(func() {
+		rateLimiter = NewRateLimiterFromConfig(util.GetConfig())
 	})
+	return rateLimiter
 }
@@ -0,0 +1,269 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kafkaesque-io/pulsar-beam/src/util"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// the default token bucket limits of every tenant on every route, the rate limit is disabled by default
+const (
+	defaultRatePerSecond = 0
+	defaultRateBurst     = 200
+
+	// an idle bucket is evicted after the ttl
+	bucketTTL = 10 * time.Minute
+)
+
+// throttledRequests counts the requests rejected by the rate limiter
+// The tenant is not a label since it is not authenticated on every route.
+var throttledRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "pulsar_beam_throttled_requests_total",
+		Help: "The number of HTTP requests rejected by the rate limiter.",
+	},
+	[]string{"route"},
+)
+
+func init() {
+	prometheus.MustRegister(throttledRequests)
+}
+
+// RateLimit is the token bucket limit, a zero rate disables the rate limit
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// tokenBucket refills tokens at the rate up to the burst size
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+	sync.Mutex
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   now,
+	}
+}
+
+// take takes a token from the bucket if available. It returns the remaining tokens
+// and the wait time until the next token is available
+func (b *tokenBucket) take(now time.Time) (bool, int, time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, int(b.tokens), 0
+	}
+	wait := time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+	return false, 0, wait
+}
+
+// refund puts back a token taken by a request that turns out not to count against the bucket
+func (b *tokenBucket) refund() {
+	b.Lock()
+	defer b.Unlock()
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+1)
+}
+
+// fullIn returns the time until the bucket is full again
+func (b *tokenBucket) fullIn() time.Duration {
+	b.Lock()
+	defer b.Unlock()
+	return time.Duration((float64(b.limit.Burst) - b.tokens) / b.limit.Rate * float64(time.Second))
+}
+
+// RateLimiter is a token bucket rate limiter keyed by tenant and route
+type RateLimiter struct {
+	defaultLimit RateLimit
+	routeLimits  map[string]RateLimit
+	buckets      *util.Cache
+	sync.Mutex
+}
+
+// NewRateLimiter creates a rate limiter with the default limit and per route limits
+func NewRateLimiter(defaultLimit RateLimit, routeLimits map[string]RateLimit) *RateLimiter {
+	return &RateLimiter{
+		defaultLimit: defaultLimit,
+		routeLimits:  routeLimits,
+		buckets: util.NewCache(util.CacheOption{
+			TTL:            bucketTTL,
+			CleanInterval:  bucketTTL,
+			ExpireCallback: func(key string, value interface{}) {},
+		}),
+	}
+}
+
+// NewRateLimiterFromConfig creates a rate limiter based on the rate limit configuration
+func NewRateLimiterFromConfig(config *util.Configuration) *RateLimiter {
+	rate, err := strconv.ParseFloat(util.AssignString(config.RateLimitPerSecond, strconv.Itoa(defaultRatePerSecond)), 64)
+	if err != nil || rate < 0 {
+		log.Errorf("invalid RateLimitPerSecond %s, use default %d", config.RateLimitPerSecond, defaultRatePerSecond)
+		rate = defaultRatePerSecond
+	}
+	burst, err := strconv.Atoi(util.AssignString(config.RateLimitBurst, strconv.Itoa(defaultRateBurst)))
+	if err != nil || burst < 1 {
+		log.Errorf("invalid RateLimitBurst %s, use default %d", config.RateLimitBurst, defaultRateBurst)
+		burst = defaultRateBurst
+	}
+	routeLimits, err := ParseRouteRateLimits(config.RateLimitRoutes)
+	if err != nil {
+		log.Errorf("invalid RateLimitRoutes %s error %v", config.RateLimitRoutes, err)
+	}
+	return NewRateLimiter(RateLimit{Rate: rate, Burst: burst}, routeLimits)
+}
+
+// ParseRouteRateLimits parses a comma separated list of per route limits
+// in the format of `<route name>=<rate per second>:<burst>`, such as `Receive=500:1000,http-sse=1:5`
+func ParseRouteRateLimits(str string) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit)
+	for _, s := range strings.Split(str, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 {
+			return limits, fmt.Errorf("invalid route rate limit %s", s)
+		}
+		values := strings.SplitN(parts[1], ":", 2)
+		rate, err := strconv.ParseFloat(strings.TrimSpace(values[0]), 64)
+		if err != nil || rate < 0 {
+			return limits, fmt.Errorf("invalid route rate limit %s", s)
+		}
+		burst := int(math.Max(1, math.Ceil(rate)))
+		if len(values) == 2 {
+			if burst, err = strconv.Atoi(strings.TrimSpace(values[1])); err != nil || burst < 1 {
+				return limits, fmt.Errorf("invalid route rate limit %s", s)
+			}
+		}
+		limits[strings.TrimSpace(parts[0])] = RateLimit{Rate: rate, Burst: burst}
+	}
+	return limits, nil
+}
+
+// routeLimit returns the limit of the route or the default limit
+func (rl *RateLimiter) routeLimit(route string) RateLimit {
+	if limit, ok := rl.routeLimits[route]; ok {
+		return limit
+	}
+	return rl.defaultLimit
+}
+
+// Limit returns the middleware that rate limits requests on the route per tenant.
+// The tenant is the JWT subjects authenticated by the auth middleware, or the client IP address
+// if the route does not verify JWT. The middleware must be wrapped by the auth middleware.
+func (rl *RateLimiter) Limit(route string) func(next http.Handler) http.Handler {
+	limit := rl.routeLimit(route)
+	return func(next http.Handler) http.Handler {
+		if limit.Rate <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if a, ok := r.Context().Value(admissionKey).(*admission); ok {
+				a.authenticated = true
+			}
+			tenant := requestTenant(r)
+			bucket := rl.bucket(route+"|"+tenant, limit)
+			ok, remaining, wait := bucket.take(time.Now())
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(bucket.fullIn())))
+			if !ok {
+				throttledRequests.WithLabelValues(route).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(wait)))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// admission records whether a request passes the auth middleware to reach the rate limiter
+type admission struct {
+	authenticated bool
+}
+
+// LimitAuthFailures returns the middleware that rate limits the requests failing the auth middleware on the route
+// per client IP address, so that the rejected requests are limited as well. It must wrap the auth middleware.
+func (rl *RateLimiter) LimitAuthFailures(route string) func(next http.Handler) http.Handler {
+	limit := rl.routeLimit(route)
+	return func(next http.Handler) http.Handler {
+		if limit.Rate <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// a token is taken up front so that concurrent requests cannot pass on the same token,
+			// and it is refunded once the request is authenticated
+			bucket := rl.bucket(route+"|unauthenticated|"+clientIP(r), limit)
+			if ok, _, wait := bucket.take(time.Now()); !ok {
+				throttledRequests.WithLabelValues(route).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(wait)))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			a := &admission{}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), admissionKey, a)))
+			if a.authenticated {
+				bucket.refund()
+			}
+		})
+	}
+}
+
+// bucket gets or creates the token bucket of the key
+func (rl *RateLimiter) bucket(key string, limit RateLimit) *tokenBucket {
+	rl.Lock()
+	defer rl.Unlock()
+	if obj, ok := rl.buckets.Get(key); ok {
+		if b, ok := obj.(*tokenBucket); ok {
+			return b
+		}
+	}
+	b := newTokenBucket(limit, time.Now())
+	rl.buckets.Set(key, b)
+	return b
+}
+
+// requestTenant returns the JWT subjects authenticated by the auth middleware or the client IP address
+// The injectedSubs header is not trusted since it can be sent by a client on a route without JWT verification.
+func requestTenant(r *http.Request) string {
+	if subjects, ok := Subjects(r); ok {
+		return subjects
+	}
+	return clientIP(r)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
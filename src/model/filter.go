@@ -0,0 +1,483 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// the max length of a filter expression
+const maxFilterLength = 1024
+
+// Filter - a compiled message filter expression
+// An expression compares the message key, a property, or a field of the JSON payload with a literal, such as
+//
+//	key == 'order' && (properties.region != 'eu' || payload.amount >= 100)
+//
+// Literals are single or double quoted strings, numbers, true, false, and null. A field is referred to by a dotted
+// path, or a quoted segment in brackets for a name with other characters, such as properties['x.y'] or payload.items.0.
+// A field alone is true if it exists and is not null. A missing field equals null, and a comparison of different
+// types is false except !=. A property is compared as a number if the literal is a number.
+type Filter struct {
+	expr        string
+	root        filterNode
+	usesPayload bool
+}
+
+// ParseFilter compiles a filter expression, it returns nil for an empty expression
+func ParseFilter(expr string) (*Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	if len(expr) > maxFilterLength {
+		return nil, fmt.Errorf("filter expression exceeds the max length %d", maxFilterLength)
+	}
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %v", err)
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %s", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %v", err)
+	}
+	return &Filter{expr: expr, root: root, usesPayload: p.usesPayload}, nil
+}
+
+// UsesPayload returns true if the filter refers to the payload, so that the payload is only decoded when it is needed
+func (f *Filter) UsesPayload() bool {
+	return f != nil && f.usesPayload
+}
+
+// Match evaluates the filter against the message key, properties, and JSON payload. A nil filter matches any message.
+// A payload that is not JSON has no field.
+func (f *Filter) Match(key string, properties map[string]string, payload []byte) bool {
+	if f == nil {
+		return true
+	}
+	m := &filterMessage{key: key, properties: properties}
+	if f.usesPayload {
+		if err := json.Unmarshal(payload, &m.payload); err != nil {
+			m.payload = nil
+		}
+	}
+	return f.root.eval(m)
+}
+
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.expr
+}
+
+// filterMessage is the message fields evaluated by a filter
+type filterMessage struct {
+	key        string
+	properties map[string]string
+	payload    interface{}
+}
+
+type filterNode interface {
+	eval(m *filterMessage) bool
+}
+
+type orNode struct{ left, right filterNode }
+
+func (n orNode) eval(m *filterMessage) bool { return n.left.eval(m) || n.right.eval(m) }
+
+type andNode struct{ left, right filterNode }
+
+func (n andNode) eval(m *filterMessage) bool { return n.left.eval(m) && n.right.eval(m) }
+
+type notNode struct{ node filterNode }
+
+func (n notNode) eval(m *filterMessage) bool { return !n.node.eval(m) }
+
+// the sources of a filter field
+const (
+	fieldKey        = "key"
+	fieldProperties = "properties"
+	fieldPayload    = "payload"
+)
+
+type fieldNode struct {
+	source string
+	path   []string
+}
+
+// value returns the field value, nil if it is missing
+func (n fieldNode) value(m *filterMessage) interface{} {
+	switch n.source {
+	case fieldKey:
+		return m.key
+	case fieldProperties:
+		if v, ok := m.properties[n.path[0]]; ok {
+			return v
+		}
+		return nil
+	}
+	v := m.payload
+	for _, segment := range n.path {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			v = node[segment]
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			v = node[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+func (n fieldNode) eval(m *filterMessage) bool {
+	v := n.value(m)
+	if s, ok := v.(string); ok && n.source == fieldKey {
+		return s != ""
+	}
+	return v != nil
+}
+
+type compareNode struct {
+	field   fieldNode
+	op      string
+	literal interface{}
+}
+
+func (n compareNode) eval(m *filterMessage) bool {
+	v := n.field.value(m)
+	if n.op == "!=" {
+		return !equalValues(v, n.literal)
+	}
+	if n.op == "==" {
+		return equalValues(v, n.literal)
+	}
+
+	var c int
+	switch lit := n.literal.(type) {
+	case float64:
+		num, ok := toNumber(v)
+		if !ok {
+			return false
+		}
+		c = compareFloat(num, lit)
+	case string:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		c = strings.Compare(s, lit)
+	default:
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func equalValues(v, literal interface{}) bool {
+	switch lit := literal.(type) {
+	case nil:
+		return v == nil
+	case float64:
+		num, ok := toNumber(v)
+		return ok && num == lit
+	case string, bool:
+		return v == literal
+	}
+	return false
+}
+
+// toNumber converts a JSON number, or a key or property string, to a number
+func toNumber(v interface{}) (float64, bool) {
+	switch value := v.(type) {
+	case float64:
+		return value, true
+	case string:
+		num, err := strconv.ParseFloat(value, 64)
+		return num, err == nil
+	}
+	return 0, false
+}
+
+func compareFloat(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// filter tokens
+const (
+	tokenField = iota
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+type filterToken struct {
+	kind int
+	text string
+	// the segments of a field path, or the unquoted string
+	path  []string
+	value string
+}
+
+// lexFilter splits a filter expression into tokens
+func lexFilter(expr string) ([]filterToken, error) {
+	tokens := []filterToken{}
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'' || c == '"':
+			s, n, err := lexQuoted(expr[i:])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, text: expr[i : i+n], value: s})
+			i += n
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(expr) && strings.IndexByte("0123456789.eE+-", expr[j]) >= 0 {
+				j++
+			}
+			if _, err := strconv.ParseFloat(expr[i:j], 64); err != nil {
+				return nil, fmt.Errorf("invalid number %s", expr[i:j])
+			}
+			tokens = append(tokens, filterToken{kind: tokenNumber, text: expr[i:j], value: expr[i:j]})
+			i = j
+		case isIdentifierByte(c):
+			path, n, err := lexPath(expr[i:])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, filterToken{kind: tokenField, text: expr[i : i+n], path: path})
+			i += n
+		default:
+			op := ""
+			for _, o := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")"} {
+				if strings.HasPrefix(expr[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			tokens = append(tokens, filterToken{kind: tokenOperator, text: op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// lexQuoted reads a quoted string with backslash escapes, it returns the string and the number of bytes read
+func lexQuoted(expr string) (string, int, error) {
+	quote := expr[0]
+	var sb strings.Builder
+	for i := 1; i < len(expr); i++ {
+		switch expr[i] {
+		case '\\':
+			if i+1 == len(expr) {
+				return "", 0, fmt.Errorf("unterminated string %s", expr)
+			}
+			i++
+			sb.WriteByte(expr[i])
+		case quote:
+			return sb.String(), i + 1, nil
+		default:
+			sb.WriteByte(expr[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string %s", expr)
+}
+
+// lexPath reads a field path of dotted segments and quoted segments in brackets
+func lexPath(expr string) ([]string, int, error) {
+	path := []string{}
+	i := 0
+	segment := func() {
+		j := i
+		for j < len(expr) && (isIdentifierByte(expr[j]) || expr[j] == '-' || (expr[j] >= '0' && expr[j] <= '9')) {
+			j++
+		}
+		path = append(path, expr[i:j])
+		i = j
+	}
+	segment()
+	for i < len(expr) {
+		if expr[i] == '.' {
+			i++
+			segment()
+			if path[len(path)-1] == "" {
+				return nil, 0, fmt.Errorf("invalid field %s", expr[:i])
+			}
+		} else if expr[i] == '[' {
+			if i+1 == len(expr) || (expr[i+1] != '\'' && expr[i+1] != '"') {
+				return nil, 0, fmt.Errorf("a bracket field name must be quoted in %s", expr)
+			}
+			s, n, err := lexQuoted(expr[i+1:])
+			if err != nil {
+				return nil, 0, err
+			}
+			i += n + 1
+			if i == len(expr) || expr[i] != ']' {
+				return nil, 0, fmt.Errorf("missing ] in %s", expr[:i])
+			}
+			i++
+			path = append(path, s)
+		} else {
+			break
+		}
+	}
+	return path, i, nil
+}
+
+// filterParser is a recursive descent parser of the filter tokens
+type filterParser struct {
+	tokens      []filterToken
+	pos         int
+	usesPayload bool
+}
+
+func (p *filterParser) peek(op string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenOperator && p.tokens[p.pos].text == op
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek("||") {
+		p.pos++
+		var right filterNode
+		if right, err = p.parseAnd(); err == nil {
+			left = orNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.peek("&&") {
+		p.pos++
+		var right filterNode
+		if right, err = p.parseUnary(); err == nil {
+			left = andNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	if p.peek("!") {
+		p.pos++
+		node, err := p.parseUnary()
+		return notNode{node}, err
+	}
+	if p.peek("(") {
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	token := p.tokens[p.pos]
+	if token.kind != tokenField {
+		return nil, fmt.Errorf("expect a field instead of %s", token.text)
+	}
+	p.pos++
+	field, err := p.field(token)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if !p.peek(op) {
+			continue
+		}
+		p.pos++
+		if p.pos >= len(p.tokens) {
+			return nil, fmt.Errorf("missing literal after %s", op)
+		}
+		literal, err := p.literal(p.tokens[p.pos])
+		if err != nil {
+			return nil, err
+		}
+		p.pos++
+		return compareNode{field: field, op: op, literal: literal}, nil
+	}
+	return field, nil
+}
+
+func (p *filterParser) field(token filterToken) (fieldNode, error) {
+	source, path := token.path[0], token.path[1:]
+	switch source {
+	case fieldKey:
+		if len(path) == 0 {
+			return fieldNode{source: source}, nil
+		}
+	case fieldProperties:
+		if len(path) == 1 {
+			return fieldNode{source: source, path: path}, nil
+		}
+	case fieldPayload:
+		p.usesPayload = true
+		return fieldNode{source: source, path: path}, nil
+	}
+	return fieldNode{}, fmt.Errorf("unsupported field %s, supported fields are key, properties.<name>, and payload.<path>", token.text)
+}
+
+func (p *filterParser) literal(token filterToken) (interface{}, error) {
+	switch token.kind {
+	case tokenString:
+		return token.value, nil
+	case tokenNumber:
+		return strconv.ParseFloat(token.value, 64)
+	case tokenField:
+		switch token.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("expect a literal instead of %s", token.text)
+}
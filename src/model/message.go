@@ -1,27 +1,59 @@
 package model
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/apache/pulsar-client-go/pulsar"
 )
 
 // PulsarMessage is the Pulsar Message type
+// MessageID is the message id in the Pulsar client's string format, which is kept for the existing poll clients.
+// MessageIDEncoded is the base64 encoded message id, which is accepted by the seek and read endpoints.
+// ReceiptHandle acknowledges a message polled without auto acknowledgement, it changes on every delivery.
 type PulsarMessage struct {
-	Payload     []byte    `json:"payload"`
-	Topic       string    `json:"topic"`
-	EventTime   time.Time `json:"eventTime"`
-	PublishTime time.Time `json:"publishTime"`
-	MessageID   string    `json:"messageId"`
-	Key         string    `json:"key"`
+	Payload          []byte            `json:"payload"`
+	Topic            string            `json:"topic"`
+	EventTime        time.Time         `json:"eventTime"`
+	PublishTime      time.Time         `json:"publishTime"`
+	MessageID        string            `json:"messageId"`
+	MessageIDEncoded string            `json:"messageIdEncoded"`
+	Key              string            `json:"key"`
+	Properties       map[string]string `json:"properties,omitempty"`
+	ReceiptHandle    string            `json:"receiptHandle,omitempty"`
+}
+
+// PulsarTextMessage is a Pulsar message with a UTF-8 payload instead of base64
+type PulsarTextMessage struct {
+	PulsarMessage
+	Payload string `json:"payload"`
+}
+
+// NewPulsarMessage creates a PulsarMessage from a Pulsar message and its decoded payload
+func NewPulsarMessage(msg pulsar.Message, payload []byte) PulsarMessage {
+	return PulsarMessage{
+		Payload:          payload,
+		Topic:            msg.Topic(),
+		EventTime:        msg.EventTime(),
+		PublishTime:      msg.PublishTime(),
+		MessageID:        fmt.Sprintf("%+v", msg.ID()),
+		MessageIDEncoded: MessageIDString(msg.ID()),
+		Key:              msg.Key(),
+		Properties:       msg.Properties(),
+	}
 }
 
 // PulsarMessages encapsulates a list of messages to be returned to a client
+// Cursor is the continuation cursor of a page read by a reader, which is the message id of the last message.
 type PulsarMessages struct {
 	Limit    int             `json:"limit"`
 	Size     int             `json:"size"`
 	Messages []PulsarMessage `json:"messages"`
+	Cursor   string          `json:"cursor,omitempty"`
 }
 
 // NewPulsarMessages create a PulsarMessages object
@@ -33,19 +65,17 @@ func NewPulsarMessages(initSize int) PulsarMessages {
 	}
 }
 
-// AddPulsarMessage adds a Pulsar Message to the payload, return true if reaches capacity
-func (msgs *PulsarMessages) AddPulsarMessage(msg pulsar.Message) bool {
+// AddPulsarMessage adds a Pulsar Message with its decoded payload, return true if reaches capacity
+func (msgs *PulsarMessages) AddPulsarMessage(msg pulsar.Message, payload []byte) bool {
+	return msgs.Add(NewPulsarMessage(msg, payload))
+}
+
+// Add adds a message, return true if reaches capacity
+func (msgs *PulsarMessages) Add(msg PulsarMessage) bool {
 	if msgs.Size >= msgs.Limit {
 		return true
 	}
-	msgs.Messages = append(msgs.Messages, PulsarMessage{
-		Payload:     msg.Payload(),
-		Topic:       msg.Topic(),
-		EventTime:   msg.EventTime(),
-		PublishTime: msg.PublishTime(),
-		MessageID:   fmt.Sprintf("%+v", msg.ID()),
-		Key:         msg.Key(),
-	})
+	msgs.Messages = append(msgs.Messages, msg)
 	msgs.Size++
 
 	return msgs.Size >= msgs.Limit
@@ -55,3 +85,265 @@ func (msgs *PulsarMessages) AddPulsarMessage(msg pulsar.Message) bool {
 func (msgs *PulsarMessages) IsEmpty() bool {
 	return msgs.Size == 0
 }
+
+// AckRequest is the request body to acknowledge or negatively acknowledge polled messages by their receipt handles
+type AckRequest struct {
+	ReceiptHandles []string `json:"receiptHandles"`
+}
+
+// AckResponse reports the receipt handles processed, a failed receipt handle is unknown to the subscription
+// or its visibility timeout has expired.
+type AckResponse struct {
+	Succeeded []string `json:"succeeded"`
+	Failed    []string `json:"failed"`
+}
+
+// WebhookBatchMessage is a message in a batch delivered to webhook
+// The metadata is equivalent to the Pulsar headers of a single message delivery.
+// Payload is inlined if it is a valid JSON, otherwise it is base64 encoded in PayloadBase64.
+type WebhookBatchMessage struct {
+	MessageID     string            `json:"messageId"`
+	Topic         string            `json:"topic"`
+	PublishTime   time.Time         `json:"publishTime"`
+	EventTime     *time.Time        `json:"eventTime,omitempty"`
+	Key           string            `json:"key,omitempty"`
+	Properties    map[string]string `json:"properties,omitempty"`
+	Payload       json.RawMessage   `json:"payload,omitempty"`
+	PayloadBase64 []byte            `json:"payloadBase64,omitempty"`
+}
+
+// NewWebhookBatchMessage creates a batch message from a Pulsar message and its decoded payload
+func NewWebhookBatchMessage(msg pulsar.Message, payload []byte) WebhookBatchMessage {
+	m := WebhookBatchMessage{
+		MessageID:   fmt.Sprintf("%#v", msg.ID()),
+		Topic:       msg.Topic(),
+		PublishTime: msg.PublishTime(),
+		Key:         msg.Key(),
+		Properties:  msg.Properties(),
+	}
+	if eventTime := msg.EventTime(); !eventTime.IsZero() {
+		m.EventTime = &eventTime
+	}
+	if json.Valid(payload) {
+		m.Payload = payload
+	} else {
+		m.PayloadBase64 = payload
+	}
+	return m
+}
+
+// WebhookBatchResponse is an optional webhook response body to a batch delivery
+// FailedIndices are the indices of messages failed to be processed in a partial success response.
+type WebhookBatchResponse struct {
+	FailedIndices []int `json:"failedIndices"`
+}
+
+// MessageIDString encodes a Pulsar message id in base64 of its serialized form,
+// the same message id format used by the Pulsar WebSocket API
+func MessageIDString(id pulsar.MessageID) string {
+	return base64.StdEncoding.EncodeToString(id.Serialize())
+}
+
+// ParseMessageID decodes a message id encoded by MessageIDString
+func ParseMessageID(str string) (pulsar.MessageID, error) {
+	data, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message id %s", str)
+	}
+	id, err := pulsar.DeserializeMessageID(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message id %s", str)
+	}
+	return id, nil
+}
+
+// FirehoseResponse is the response of a message published to the firehose
+// The message id is absent in async mode.
+type FirehoseResponse struct {
+	// MessageID is the base64 encoded message id that can be used to seek
+	MessageID    string  `json:"messageId,omitempty"`
+	LedgerID     int64   `json:"ledgerId"`
+	EntryID      int64   `json:"entryId"`
+	PartitionIdx int32   `json:"partitionIdx"`
+	BatchIdx     int32   `json:"batchIdx"`
+	PulsarBeamID string  `json:"pulsarBeamId"`
+	LatencyMs    float64 `json:"latencyMs"`
+}
+
+// NewFirehoseResponse creates the response of a published message, the message id can be nil
+func NewFirehoseResponse(id pulsar.MessageID, beamID string, latency time.Duration) FirehoseResponse {
+	res := FirehoseResponse{
+		PulsarBeamID: beamID,
+		LatencyMs:    float64(latency.Microseconds()) / 1000,
+	}
+	if id != nil {
+		res.MessageID = MessageIDString(id)
+		res.LedgerID = id.LedgerID()
+		res.EntryID = id.EntryID()
+		res.PartitionIdx = id.PartitionIdx()
+		res.BatchIdx = id.BatchIdx()
+	}
+	return res
+}
+
+// the status of an async send
+const (
+	AsyncSendPending  = "pending"
+	AsyncSendRetrying = "retrying"
+	AsyncSendSent     = "sent"
+	AsyncSendFailed   = "failed"
+	AsyncSendDropped  = "dropped"
+)
+
+// AsyncSendStatus is the outcome of a message sent in async mode
+type AsyncSendStatus struct {
+	PulsarBeamID string    `json:"pulsarBeamId"`
+	Topic        string    `json:"topic"`
+	Status       string    `json:"status"`
+	Attempts     int       `json:"attempts"`
+	MessageID    string    `json:"messageId,omitempty"`
+	LastError    string    `json:"lastError,omitempty"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// the max number of messages in a firehose batch
+const maxFirehoseBatchSize = 1000
+
+// FirehoseMessage is a message in a batch published to the firehose
+// Payload is a JSON value sent as is, otherwise PayloadBase64 is the base64 encoded payload.
+type FirehoseMessage struct {
+	Payload       json.RawMessage   `json:"payload,omitempty"`
+	PayloadBase64 []byte            `json:"payloadBase64,omitempty"`
+	Key           string            `json:"key,omitempty"`
+	Properties    map[string]string `json:"properties,omitempty"`
+	EventTime     *time.Time        `json:"eventTime,omitempty"`
+}
+
+// Data returns the payload of the message
+func (m FirehoseMessage) Data() []byte {
+	if len(m.Payload) > 0 {
+		return m.Payload
+	}
+	return m.PayloadBase64
+}
+
+// ParseFirehoseMessages parses either a JSON array or newline delimited JSON of firehose messages
+func ParseFirehoseMessages(data []byte) ([]FirehoseMessage, error) {
+	data = bytes.TrimSpace(data)
+	msgs := []FirehoseMessage{}
+	if bytes.HasPrefix(data, []byte("[")) {
+		if err := json.Unmarshal(data, &msgs); err != nil {
+			return nil, fmt.Errorf("invalid JSON array of messages %v", err)
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		for {
+			var msg FirehoseMessage
+			if err := decoder.Decode(&msg); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("invalid message at index %d %v", len(msgs), err)
+			}
+			msgs = append(msgs, msg)
+		}
+	}
+
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("no message in the batch")
+	}
+	if len(msgs) > maxFirehoseBatchSize {
+		return nil, fmt.Errorf("the batch exceeds the max size of %d messages", maxFirehoseBatchSize)
+	}
+	for i, msg := range msgs {
+		if len(msg.Payload) > 0 && len(msg.PayloadBase64) > 0 {
+			return nil, fmt.Errorf("message at index %d cannot have both payload and payloadBase64", i)
+		}
+		if len(msg.Data()) == 0 {
+			return nil, fmt.Errorf("message at index %d has no payload", i)
+		}
+	}
+	return msgs, nil
+}
+
+// FirehoseResult is the publish result of a message in a firehose batch
+type FirehoseResult struct {
+	Index        int    `json:"index"`
+	MessageID    string `json:"messageId,omitempty"`
+	PulsarBeamID string `json:"pulsarBeamId,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// FirehoseBatchResponse is the response of a firehose batch
+type FirehoseBatchResponse struct {
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []FirehoseResult `json:"results"`
+}
+
+// the frame types of the WebSocket endpoint
+const (
+	// client frames
+	WebSocketAck     = "ack"
+	WebSocketNack    = "nack"
+	WebSocketFlow    = "flow"
+	WebSocketPublish = "publish"
+
+	// server frames
+	WebSocketMessageType = "message"
+	WebSocketPublished   = "published"
+	WebSocketError       = "error"
+)
+
+// WebSocketRequest is a frame sent by a WebSocket client
+// An ack or nack frame has the message id, a flow frame grants more permits to receive messages,
+// and a publish frame carries a message the same as the firehose batch with an optional context
+// that is returned in the published or error frame.
+type WebSocketRequest struct {
+	Type      string `json:"type"`
+	MessageID string `json:"messageId,omitempty"`
+	Permits   int    `json:"permits,omitempty"`
+	Context   string `json:"context,omitempty"`
+	FirehoseMessage
+}
+
+// WebSocketMessage is a frame sent to a WebSocket client
+// A message frame delivers a Pulsar message, whose base64 encoded message id is used to ack or nack.
+// Payload is inlined if it is a valid JSON, otherwise it is base64 encoded in PayloadBase64.
+type WebSocketMessage struct {
+	Type            string            `json:"type"`
+	MessageID       string            `json:"messageId,omitempty"`
+	Topic           string            `json:"topic,omitempty"`
+	PublishTime     *time.Time        `json:"publishTime,omitempty"`
+	EventTime       *time.Time        `json:"eventTime,omitempty"`
+	Key             string            `json:"key,omitempty"`
+	Properties      map[string]string `json:"properties,omitempty"`
+	RedeliveryCount uint32            `json:"redeliveryCount,omitempty"`
+	Payload         json.RawMessage   `json:"payload,omitempty"`
+	PayloadBase64   []byte            `json:"payloadBase64,omitempty"`
+	Context         string            `json:"context,omitempty"`
+	PulsarBeamID    string            `json:"pulsarBeamId,omitempty"`
+	Error           string            `json:"error,omitempty"`
+}
+
+// NewWebSocketMessage creates a message frame from a Pulsar message and its decoded payload
+func NewWebSocketMessage(msg pulsar.Message, payload []byte) WebSocketMessage {
+	publishTime := msg.PublishTime()
+	m := WebSocketMessage{
+		Type:            WebSocketMessageType,
+		MessageID:       MessageIDString(msg.ID()),
+		Topic:           msg.Topic(),
+		PublishTime:     &publishTime,
+		Key:             msg.Key(),
+		Properties:      msg.Properties(),
+		RedeliveryCount: msg.RedeliveryCount(),
+	}
+	if eventTime := msg.EventTime(); !eventTime.IsZero() {
+		m.EventTime = &eventTime
+	}
+	if json.Valid(payload) {
+		m.Payload = payload
+	} else {
+		m.PayloadBase64 = payload
+	}
+	return m
+}
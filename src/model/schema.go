@@ -0,0 +1,155 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/linkedin/goavro/v2"
+)
+
+// the supported topic schema types
+const (
+	JSONSchemaType = "json"
+	AvroSchemaType = "avro"
+)
+
+// TopicSchema - an optional schema of a topic
+// Definition is an Avro record schema, which Pulsar uses to describe both JSON and Avro schemas.
+// A JSON message is validated against the definition and published as is with the json type,
+// and it is encoded to Avro binary with the avro type.
+type TopicSchema struct {
+	Type       string `json:"type"`
+	Definition string `json:"definition"`
+}
+
+// schemaCodecs caches the compiled codec of every schema definition
+var schemaCodecs sync.Map
+
+// codec returns the compiled codec that accepts standard JSON for union types
+func (s *TopicSchema) codec() (*goavro.Codec, error) {
+	if c, ok := schemaCodecs.Load(s.Definition); ok {
+		return c.(*goavro.Codec), nil
+	}
+	c, err := goavro.NewCodecForStandardJSON(s.Definition)
+	if err != nil {
+		return nil, err
+	}
+	schemaCodecs.Store(s.Definition, c)
+	return c, nil
+}
+
+// validateSchema validates the schema type and definition
+func validateSchema(s *TopicSchema) error {
+	if s == nil {
+		return nil
+	}
+	switch strings.ToLower(s.Type) {
+	case JSONSchemaType, AvroSchemaType:
+	default:
+		return fmt.Errorf("unsupported schema type %s, supported types are json and avro", s.Type)
+	}
+	if _, err := s.codec(); err != nil {
+		return fmt.Errorf("invalid schema definition %v", err)
+	}
+	return nil
+}
+
+func (s *TopicSchema) isAvro() bool {
+	return strings.ToLower(s.Type) == AvroSchemaType
+}
+
+// Encode validates a JSON payload against the schema, and encodes it to the wire format of the schema type.
+// The payload is returned as is if the schema is nil.
+func (s *TopicSchema) Encode(payload []byte) ([]byte, error) {
+	if s == nil {
+		return payload, nil
+	}
+	c, err := s.codec()
+	if err != nil {
+		return nil, err
+	}
+	native, _, err := c.NativeFromTextual(payload)
+	if err != nil {
+		return nil, fmt.Errorf("payload does not match the schema %v", err)
+	}
+	if !s.isAvro() {
+		return payload, nil
+	}
+	return c.BinaryFromNative(nil, native)
+}
+
+// Decode decodes a payload in the wire format of the schema type to JSON.
+// The payload is returned as is if the schema is nil.
+func (s *TopicSchema) Decode(payload []byte) ([]byte, error) {
+	if s == nil || !s.isAvro() {
+		return payload, nil
+	}
+	c, err := s.codec()
+	if err != nil {
+		return nil, err
+	}
+	native, _, err := c.NativeFromBinary(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode avro payload %v", err)
+	}
+	return c.TextualFromNative(nil, native)
+}
+
+// PulsarSchema returns the Pulsar schema to be registered by a producer, nil if the schema is nil
+func (s *TopicSchema) PulsarSchema() pulsar.Schema {
+	if s == nil {
+		return nil
+	}
+	info := pulsar.SchemaInfo{
+		Name:   "JSON",
+		Type:   pulsar.JSON,
+		Schema: s.Definition,
+	}
+	if c, err := s.codec(); err == nil {
+		info.Schema = c.Schema()
+	}
+	if s.isAvro() {
+		info.Name = "Avro"
+		info.Type = pulsar.AVRO
+	}
+	return &encodedSchema{topic: s, info: info}
+}
+
+// encodedSchema is a Pulsar schema for payloads already encoded by the TopicSchema.
+// The Pulsar producer encodes the message Value with the schema even if the Payload is set,
+// so that a nil Value is encoded to nil and the Payload is sent as is.
+type encodedSchema struct {
+	topic *TopicSchema
+	info  pulsar.SchemaInfo
+}
+
+func (es *encodedSchema) Encode(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return es.topic.Encode(data)
+}
+
+func (es *encodedSchema) Decode(data []byte, v interface{}) error {
+	decoded, err := es.topic.Decode(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, v)
+}
+
+func (es *encodedSchema) Validate(message []byte) error {
+	_, err := es.topic.Decode(message)
+	return err
+}
+
+func (es *encodedSchema) GetSchemaInfo() *pulsar.SchemaInfo {
+	return &es.info
+}
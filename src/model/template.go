@@ -0,0 +1,135 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"golang.org/x/net/http/httpguts"
+)
+
+// the max length of a webhook body or header template
+const maxTemplateLength = 16 * 1024
+
+// WebhookTemplate - Go text/template templates that transform a message into the webhook request body and headers
+// Body replaces the payload as the request body if it is not empty. Every header is a name:value template,
+// which is added after the static webhook headers. The templates are executed with TemplateData.
+type WebhookTemplate struct {
+	Body    string   `json:"body,omitempty"`
+	Headers []string `json:"headers,omitempty"`
+}
+
+// TemplateData - the message fields available to a webhook template
+// Payload is the parsed JSON payload, or the payload string if it is not JSON.
+type TemplateData struct {
+	Payload     interface{}
+	RawPayload  string
+	Key         string
+	Properties  map[string]string
+	Topic       string
+	MessageID   string
+	PublishTime time.Time
+	EventTime   time.Time
+}
+
+// NewTemplateData creates the template data of a message with its decoded payload
+func NewTemplateData(msg pulsar.Message, payload []byte) TemplateData {
+	data := TemplateData{
+		RawPayload:  string(payload),
+		Key:         msg.Key(),
+		Properties:  msg.Properties(),
+		Topic:       msg.Topic(),
+		MessageID:   MessageIDString(msg.ID()),
+		PublishTime: msg.PublishTime(),
+		EventTime:   msg.EventTime(),
+	}
+	if err := json.Unmarshal(payload, &data.Payload); err != nil {
+		data.Payload = data.RawPayload
+	}
+	return data
+}
+
+// templateFuncs are the functions available to webhook templates in addition to the text/template builtins
+var templateFuncs = template.FuncMap{
+	// json encodes a value, such as a payload field, to embed it in a JSON body
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// WebhookRenderer is a compiled WebhookTemplate
+type WebhookRenderer struct {
+	body    *template.Template
+	headers []headerTemplate
+}
+
+type headerTemplate struct {
+	name  string
+	value *template.Template
+}
+
+// CompileWebhookTemplate compiles the webhook templates, it returns nil if the template is nil
+func CompileWebhookTemplate(t *WebhookTemplate) (*WebhookRenderer, error) {
+	if t == nil {
+		return nil, nil
+	}
+	r := &WebhookRenderer{}
+	var err error
+	if t.Body != "" {
+		if r.body, err = parseTemplate("body", t.Body); err != nil {
+			return nil, err
+		}
+	}
+	for _, h := range t.Headers {
+		kv := strings.SplitN(h, ":", 2)
+		name := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || !httpguts.ValidHeaderFieldName(name) {
+			return nil, fmt.Errorf("template header %s must be in the name:value format with a valid header name", h)
+		}
+		value, err := parseTemplate(name, strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, err
+		}
+		r.headers = append(r.headers, headerTemplate{name: name, value: value})
+	}
+	return r, nil
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	if len(text) > maxTemplateLength {
+		return nil, fmt.Errorf("template %s exceeds the max length %d", name, maxTemplateLength)
+	}
+	t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %v", err)
+	}
+	return t, nil
+}
+
+// Render executes the templates, the body is nil if there is no body template
+// A line break in a header value is replaced by a space.
+func (r *WebhookRenderer) Render(data TemplateData) ([]byte, []string, error) {
+	var body []byte
+	if r.body != nil {
+		var buf bytes.Buffer
+		if err := r.body.Execute(&buf, data); err != nil {
+			return nil, nil, err
+		}
+		body = buf.Bytes()
+	}
+	headers := make([]string, 0, len(r.headers))
+	for _, h := range r.headers {
+		var buf strings.Builder
+		if err := h.value.Execute(&buf, data); err != nil {
+			return nil, nil, err
+		}
+		value := strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(buf.String())
+		headers = append(headers, h.name+":"+value)
+	}
+	return body, headers, nil
+}
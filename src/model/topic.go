@@ -5,6 +5,8 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"mime"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
@@ -12,6 +14,7 @@ import (
 
 	"github.com/apache/pulsar-client-go/pulsar"
 	"github.com/kafkaesque-io/pulsar-beam/src/icrypto"
+	"github.com/kafkaesque-io/pulsar-beam/src/util"
 )
 
 // Status can be used for webhook status
@@ -31,18 +34,183 @@ const (
 
 // WebhookConfig - a configuration for webhook
 type WebhookConfig struct {
-	URL              string    `json:"url"`
-	Headers          []string  `json:"headers"`
-	Subscription     string    `json:"subscription"`
-	SubscriptionType string    `json:"subscriptionType"`
-	InitialPosition  string    `json:"initialPosition"`
-	WebhookStatus    Status    `json:"webhookStatus"`
-	CreatedAt        time.Time `json:"createdAt"`
-	UpdatedAt        time.Time `json:"updatedAt"`
-	DeletedAt        time.Time `json:"deletedAt"`
+	URL              string           `json:"url"`
+	Headers          []string         `json:"headers"`
+	Subscription     string           `json:"subscription"`
+	SubscriptionType string           `json:"subscriptionType"`
+	InitialPosition  string           `json:"initialPosition"`
+	WebhookStatus    Status           `json:"webhookStatus"`
+	DeadLetterPolicy DeadLetterPolicy `json:"deadLetterPolicy"`
+	RetryPolicy      *RetryPolicy     `json:"retryPolicy,omitempty"`
+	SigningSecret    string           `json:"signingSecret,omitempty"`
+	StatusReason     string           `json:"statusReason"`
+	Batch            *BatchPolicy     `json:"batch,omitempty"`
+	Concurrency      int              `json:"concurrency,omitempty"`
+	Filter           string           `json:"filter,omitempty"`
+	Template         *WebhookTemplate `json:"template,omitempty"`
+	Method           string           `json:"method,omitempty"`
+	ContentType      string           `json:"contentType,omitempty"`
+	Auth             *WebhookAuth     `json:"auth,omitempty"`
+	CreatedAt        time.Time        `json:"createdAt"`
+	UpdatedAt        time.Time        `json:"updatedAt"`
+	DeletedAt        time.Time        `json:"deletedAt"`
 }
 
-//TODO add state of Webhook replies
+// DeadLetterPolicy - a policy to route messages that a webhook keeps failing to a dead-letter topic
+// The policy is disabled when MaxDeliveries is 0.
+type DeadLetterPolicy struct {
+	// MaxDeliveries is the number of delivery attempts before a message is routed to the dead-letter topic
+	MaxDeliveries uint32 `json:"maxDeliveries"`
+	// DeadLetterTopic is the topic full name, default to <topic>-<subscription>-DLQ
+	DeadLetterTopic string `json:"deadLetterTopic"`
+}
+
+// RetryPolicy - a retry and backoff policy of webhook delivery
+// The default policy is applied if a webhook does not specify one.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first failed attempt, 0 disables retry
+	MaxRetries int `json:"maxRetries"`
+	// MinBackoff and MaxBackoff are duration strings such as 2s, the defaults are 2s and 28s
+	MinBackoff string `json:"minBackoff"`
+	MaxBackoff string `json:"maxBackoff"`
+	// Jitter randomizes the backoff between MinBackoff and the exponential backoff
+	Jitter bool `json:"jitter"`
+	// RetryableStatusCodes overrides the default retryable codes, 429 and 5xx except 501
+	RetryableStatusCodes []int `json:"retryableStatusCodes"`
+	// Timeout is a per request timeout duration string, no timeout if empty
+	Timeout string `json:"timeout"`
+}
+
+// the maximum number of retries allowed in a retry policy
+const maxRetryLimit = 10
+
+// NewRetryPolicy returns the default webhook retry policy
+func NewRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: 1,
+		MinBackoff: "2s",
+		MaxBackoff: "28s",
+	}
+}
+
+// GetRetryPolicy returns the webhook's retry policy or the default one
+func GetRetryPolicy(wh WebhookConfig) RetryPolicy {
+	if wh.RetryPolicy == nil {
+		return NewRetryPolicy()
+	}
+	return *wh.RetryPolicy
+}
+
+// Durations parses the backoff and timeout durations of the retry policy
+func (p RetryPolicy) Durations() (minBackoff, maxBackoff, timeout time.Duration, err error) {
+	if minBackoff, err = time.ParseDuration(util.AssignString(p.MinBackoff, "2s")); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid retry policy minBackoff %s", p.MinBackoff)
+	}
+	if maxBackoff, err = time.ParseDuration(util.AssignString(p.MaxBackoff, "28s")); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid retry policy maxBackoff %s", p.MaxBackoff)
+	}
+	if p.Timeout != "" {
+		if timeout, err = time.ParseDuration(p.Timeout); err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid retry policy timeout %s", p.Timeout)
+		}
+	}
+	return minBackoff, maxBackoff, timeout, nil
+}
+
+// BatchPolicy - a batch delivery policy of webhook
+// Messages are accumulated and sent as a JSON array when any of the limits is reached.
+type BatchPolicy struct {
+	// MaxMessages is the max number of messages in a batch, the default is 100
+	MaxMessages int `json:"maxMessages"`
+	// MaxBytes is the max total payload size of a batch in bytes, the default is 1MB
+	MaxBytes int `json:"maxBytes"`
+	// MaxLinger is a duration string of the max time to wait for a batch to fill up, the default is 1s
+	MaxLinger string `json:"maxLinger"`
+}
+
+// the batch policy limits
+const (
+	defaultBatchMaxMessages = 100
+	defaultBatchMaxBytes    = 1024 * 1024
+	maxBatchMessagesLimit   = 10000
+)
+
+// Limits returns the batch policy limits with defaults applied
+func (p BatchPolicy) Limits() (maxMessages, maxBytes int, maxLinger time.Duration, err error) {
+	maxMessages, maxBytes = p.MaxMessages, p.MaxBytes
+	if maxMessages == 0 {
+		maxMessages = defaultBatchMaxMessages
+	}
+	if maxBytes == 0 {
+		maxBytes = defaultBatchMaxBytes
+	}
+	if maxLinger, err = time.ParseDuration(util.AssignString(p.MaxLinger, "1s")); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid batch maxLinger %s", p.MaxLinger)
+	}
+	return maxMessages, maxBytes, maxLinger, nil
+}
+
+// WebhookDeliveryStats - the delivery state of webhook replies
+type WebhookDeliveryStats struct {
+	LastSuccessAt       time.Time `json:"lastSuccessAt"`
+	LastFailureAt       time.Time `json:"lastFailureAt"`
+	LastStatusCode      int       `json:"lastStatusCode"`
+	LastError           string    `json:"lastError"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	InFlight            int       `json:"inFlight"`
+	Delivered           uint64    `json:"delivered"`
+	Failed              uint64    `json:"failed"`
+}
+
+// WebhookState - a webhook configuration's status and its delivery stats
+// Stats is absent until a webhook broker writes the delivery stats of the webhook to the database,
+// which it does every WebhookStatsInterval.
+type WebhookState struct {
+	URL           string                `json:"url"`
+	Subscription  string                `json:"subscription"`
+	WebhookStatus Status                `json:"webhookStatus"`
+	Stats         *WebhookDeliveryStats `json:"stats,omitempty"`
+}
+
+// the positions to seek a subscription to
+const (
+	SeekEarliest = "earliest"
+	SeekLatest   = "latest"
+)
+
+// SeekRequest - resets a subscription to exactly one of the earliest or latest position,
+// the first message published at or after the timestamp, or the base64 encoded message id.
+// Subscription is the webhook subscription name to seek, it is ignored by the poll subscription seek.
+type SeekRequest struct {
+	Subscription string     `json:"subscription,omitempty"`
+	Position     string     `json:"position,omitempty"`
+	Timestamp    *time.Time `json:"timestamp,omitempty"`
+	MessageID    string     `json:"messageId,omitempty"`
+}
+
+// ValidateSeekRequest validates the seek target
+func ValidateSeekRequest(req SeekRequest) error {
+	targets := 0
+	if req.Position != "" {
+		targets++
+		if req.Position != SeekEarliest && req.Position != SeekLatest {
+			return fmt.Errorf("unsupported position %s, supported positions are earliest and latest", req.Position)
+		}
+	}
+	if req.Timestamp != nil {
+		targets++
+	}
+	if req.MessageID != "" {
+		targets++
+		if _, err := ParseMessageID(req.MessageID); err != nil {
+			return err
+		}
+	}
+	if targets != 1 {
+		return errors.New("exactly one of position, timestamp, and messageId is required")
+	}
+	return nil
+}
 
 // TopicConfig - a configuraion for topic and its webhook configuration.
 type TopicConfig struct {
@@ -54,6 +222,7 @@ type TopicConfig struct {
 	Notes         string
 	TopicStatus   Status
 	Webhooks      []WebhookConfig
+	Schema        *TopicSchema
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 }
@@ -177,6 +346,36 @@ func ValidateWebhookConfig(whs []WebhookConfig) error {
 		if _, err := GetInitialPosition(wh.InitialPosition); err != nil {
 			return err
 		}
+		if err := validateDeadLetterPolicy(wh.DeadLetterPolicy); err != nil {
+			return err
+		}
+		if err := validateRetryPolicy(wh.RetryPolicy); err != nil {
+			return err
+		}
+		if err := validateBatchPolicy(wh.Batch); err != nil {
+			return err
+		}
+		if wh.SigningSecret != "" && len(wh.SigningSecret) < minSigningSecretLength {
+			return fmt.Errorf("signing secret must be at least %d characters", minSigningSecretLength)
+		}
+		if err := validateConcurrency(wh); err != nil {
+			return err
+		}
+		if _, err := ParseFilter(wh.Filter); err != nil {
+			return err
+		}
+		if _, err := CompileWebhookTemplate(wh.Template); err != nil {
+			return err
+		}
+		if wh.Template != nil && wh.Batch != nil {
+			return fmt.Errorf("a template cannot be combined with batch delivery")
+		}
+		if err := validateMethodAndContentType(wh); err != nil {
+			return err
+		}
+		if err := validateWebhookAuth(wh); err != nil {
+			return err
+		}
 	}
 	return nil
 
@@ -187,10 +386,204 @@ func ValidateTopicConfig(top TopicConfig) (string, error) {
 	if err := ValidateWebhookConfig(top.Webhooks); err != nil {
 		return "", err
 	}
+	if err := validateSchema(top.Schema); err != nil {
+		return "", err
+	}
 
 	return GetKeyFromNames(top.TopicFullName, top.PulsarURL)
 }
 
+// the max number of concurrent delivery workers of a webhook
+const maxConcurrencyLimit = 64
+
+// GetConcurrency returns the number of delivery workers of a webhook, the default is 1
+func GetConcurrency(wh WebhookConfig) int {
+	if wh.Concurrency < 1 {
+		return 1
+	}
+	return wh.Concurrency
+}
+
+// validateConcurrency only allows concurrent delivery on shared and key_shared subscriptions
+// since exclusive and failover subscriptions require strict ordering.
+func validateConcurrency(wh WebhookConfig) error {
+	if wh.Concurrency < 0 || wh.Concurrency > maxConcurrencyLimit {
+		return fmt.Errorf("concurrency must be between 0 and %d", maxConcurrencyLimit)
+	}
+	if wh.Concurrency <= 1 {
+		return nil
+	}
+	subType, err := GetSubscriptionType(wh.SubscriptionType)
+	if err != nil {
+		return err
+	}
+	if subType != pulsar.Shared && subType != pulsar.KeyShared {
+		return fmt.Errorf("concurrency requires a shared or keyshared subscription")
+	}
+	if wh.Batch != nil {
+		return fmt.Errorf("concurrency cannot be combined with batch delivery")
+	}
+	return nil
+}
+
+// the minimum length of a plain text webhook signing secret
+const minSigningSecretLength = 16
+
+// encryptedSecretPrefix marks an encrypted secret in the stored topic
+const encryptedSecretPrefix = "encrypted:"
+
+// EncryptWebhookSecrets encrypts plain text webhook signing secrets and auth secrets before the topic is stored.
+// An encrypted secret read back from the API is kept as is only if it is a secret of the stored topic, which is nil
+// if the topic does not exist yet. Any other secret with the encrypted prefix is rejected.
+func EncryptWebhookSecrets(top *TopicConfig, stored *TopicConfig) error {
+	storedSecrets := make(map[string]bool)
+	if stored != nil {
+		for _, secret := range webhookSecrets(stored) {
+			storedSecrets[*secret] = true
+		}
+	}
+	for _, secret := range webhookSecrets(top) {
+		if *secret == "" {
+			continue
+		}
+		if strings.HasPrefix(*secret, encryptedSecretPrefix) {
+			if !storedSecrets[*secret] {
+				return fmt.Errorf("a webhook secret cannot start with %s unless it is the stored encrypted secret", encryptedSecretPrefix)
+			}
+			continue
+		}
+		encrypted, err := icrypto.EncryptWithBase64(*secret)
+		if err != nil {
+			return err
+		}
+		*secret = encryptedSecretPrefix + encrypted
+	}
+	return nil
+}
+
+// webhookSecrets returns the pointers to the signing secrets and auth secrets of a topic's webhooks
+func webhookSecrets(top *TopicConfig) []*string {
+	secrets := []*string{}
+	for i := range top.Webhooks {
+		secrets = append(secrets, &top.Webhooks[i].SigningSecret)
+		if top.Webhooks[i].Auth != nil {
+			secrets = append(secrets, top.Webhooks[i].Auth.secrets()...)
+		}
+	}
+	return secrets
+}
+
+// decryptSecret decrypts a secret encrypted by EncryptWebhookSecrets
+func decryptSecret(secret string) (string, error) {
+	if !strings.HasPrefix(secret, encryptedSecretPrefix) {
+		return "", fmt.Errorf("secret is not encrypted")
+	}
+	decrypted, err := icrypto.DecryptWithBase64(strings.TrimPrefix(secret, encryptedSecretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted secret %v", err)
+	}
+	return decrypted, nil
+}
+
+// GetSigningSecret returns the decrypted signing secret of a webhook, nil if the webhook is not signed
+func GetSigningSecret(wh WebhookConfig) ([]byte, error) {
+	if wh.SigningSecret == "" {
+		return nil, nil
+	}
+	secret, err := decryptSecret(wh.SigningSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt webhook signing secret %v", err)
+	}
+	return []byte(secret), nil
+}
+
+// GetDeadLetterTopic returns the dead-letter topic full name for a webhook
+func GetDeadLetterTopic(topicFullName string, wh WebhookConfig) string {
+	if dlq := strings.TrimSpace(wh.DeadLetterPolicy.DeadLetterTopic); dlq != "" {
+		return dlq
+	}
+	return fmt.Sprintf("%s-%s-DLQ", topicFullName, wh.Subscription)
+}
+
+func validateDeadLetterPolicy(policy DeadLetterPolicy) error {
+	dlq := strings.TrimSpace(policy.DeadLetterTopic)
+	if dlq == "" {
+		return nil
+	}
+	if policy.MaxDeliveries == 0 {
+		return fmt.Errorf("dead-letter topic %s requires maxDeliveries to be greater than 0", dlq)
+	}
+	if _, _, _, topic, err := util.TokenizeTopicFullName(dlq); err != nil || topic == "" {
+		return fmt.Errorf("invalid dead-letter topic full name %s", dlq)
+	}
+	return nil
+}
+
+func validateRetryPolicy(policy *RetryPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.MaxRetries < 0 || policy.MaxRetries > maxRetryLimit {
+		return fmt.Errorf("retry policy maxRetries must be between 0 and %d", maxRetryLimit)
+	}
+	minBackoff, maxBackoff, timeout, err := policy.Durations()
+	if err != nil {
+		return err
+	}
+	if minBackoff < 0 || timeout < 0 || minBackoff > maxBackoff {
+		return fmt.Errorf("retry policy requires 0 <= minBackoff <= maxBackoff and non-negative timeout")
+	}
+	for _, code := range policy.RetryableStatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid retryable status code %d", code)
+		}
+	}
+	return nil
+}
+
+// GetWebhookMethod returns the HTTP method of the webhook requests, the default is POST
+func GetWebhookMethod(wh WebhookConfig) string {
+	if wh.Method == "" {
+		return http.MethodPost
+	}
+	return strings.ToUpper(wh.Method)
+}
+
+func validateMethodAndContentType(wh WebhookConfig) error {
+	switch GetWebhookMethod(wh) {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return fmt.Errorf("unsupported webhook method %s, must be POST, PUT, or PATCH", wh.Method)
+	}
+	if wh.ContentType == "" {
+		return nil
+	}
+	if _, _, err := mime.ParseMediaType(wh.ContentType); err != nil {
+		return fmt.Errorf("invalid content type %s", wh.ContentType)
+	}
+	if wh.Batch != nil {
+		return fmt.Errorf("a content type cannot be combined with batch delivery")
+	}
+	return nil
+}
+
+func validateBatchPolicy(policy *BatchPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	maxMessages, maxBytes, maxLinger, err := policy.Limits()
+	if err != nil {
+		return err
+	}
+	if maxMessages < 1 || maxMessages > maxBatchMessagesLimit {
+		return fmt.Errorf("batch maxMessages must be between 1 and %d", maxBatchMessagesLimit)
+	}
+	if maxBytes < 1 || maxLinger <= 0 {
+		return fmt.Errorf("batch maxBytes and maxLinger must be positive")
+	}
+	return nil
+}
+
 func isURL(str string) bool {
 	u, err := url.Parse(str)
 	return err == nil && u.Scheme != "" && u.Host != ""
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// webhook auth types
+const (
+	BasicAuth  = "basic"
+	BearerAuth = "bearer"
+	OAuth2Auth = "oauth2"
+)
+
+// WebhookAuth - the authorization of the requests to a webhook
+// Password, Token, and ClientSecret are encrypted before the topic is stored.
+type WebhookAuth struct {
+	// Type is basic, bearer, or oauth2
+	Type string `json:"type"`
+	// Username and Password are the basic auth credential
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Token is the bearer token
+	Token string `json:"token,omitempty"`
+	// TokenURL, ClientID, ClientSecret, and Scopes are the OAuth2 client credentials grant
+	TokenURL     string   `json:"tokenUrl,omitempty"`
+	ClientID     string   `json:"clientId,omitempty"`
+	ClientSecret string   `json:"clientSecret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+// secrets returns the pointers to the secret fields of the auth type
+func (a *WebhookAuth) secrets() []*string {
+	switch a.Type {
+	case BasicAuth:
+		return []*string{&a.Password}
+	case BearerAuth:
+		return []*string{&a.Token}
+	case OAuth2Auth:
+		return []*string{&a.ClientSecret}
+	default:
+		return nil
+	}
+}
+
+func validateWebhookAuth(wh WebhookConfig) error {
+	auth := wh.Auth
+	if auth == nil {
+		return nil
+	}
+	switch auth.Type {
+	case BasicAuth:
+		if auth.Username == "" || auth.Password == "" {
+			return fmt.Errorf("basic auth requires username and password")
+		}
+	case BearerAuth:
+		if auth.Token == "" {
+			return fmt.Errorf("bearer auth requires token")
+		}
+	case OAuth2Auth:
+		if !isURL(auth.TokenURL) || auth.ClientID == "" || auth.ClientSecret == "" {
+			return fmt.Errorf("oauth2 auth requires tokenUrl, clientId, and clientSecret")
+		}
+	default:
+		return fmt.Errorf("unsupported webhook auth type %s", auth.Type)
+	}
+	for _, h := range wh.Headers {
+		if strings.EqualFold(strings.TrimSpace(strings.SplitN(h, ":", 2)[0]), "Authorization") {
+			return fmt.Errorf("an Authorization header cannot be combined with auth")
+		}
+	}
+	return nil
+}
+
+// GetWebhookAuth returns a copy of the webhook auth with decrypted secrets, nil if the webhook has no auth
+func GetWebhookAuth(wh WebhookConfig) (*WebhookAuth, error) {
+	if wh.Auth == nil {
+		return nil, nil
+	}
+	auth := *wh.Auth
+	for _, secret := range auth.secrets() {
+		if *secret == "" {
+			continue
+		}
+		decrypted, err := decryptSecret(*secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt webhook %s auth secret %v", auth.Type, err)
+		}
+		*secret = decrypted
+	}
+	return &auth, nil
+}
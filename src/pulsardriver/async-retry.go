@@ -0,0 +1,335 @@
+package pulsardriver
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/kafkaesque-io/pulsar-beam/src/util"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// Async send retry queue
+// A message failed to be sent in async mode is pushed to a bounded local queue and re-published with
+// exponential backoff up to the max attempts. A message is dropped when the queue is full.
+// The queue is drained on shutdown within the shutdown timeout.
+// The outcome of every async send can be looked up by its PulsarBeamId until the status expires an hour after
+// its last change, or is evicted by a newer status once the status cache is full.
+
+const (
+	asyncRetryMinBackoff = 1 * time.Second
+	asyncRetryMaxBackoff = 60 * time.Second
+	asyncSendTimeout     = 30 * time.Second
+	asyncStatusTTL       = 1 * time.Hour
+)
+
+var (
+	asyncRetryQueueSize   = util.GetEnvInt("AsyncRetryQueueSize", 10000)
+	asyncRetryMaxAttempts = util.GetEnvInt("AsyncRetryMaxAttempts", 5)
+	asyncStatusCacheSize  = util.GetEnvInt("AsyncSendStatusCacheSize", 100000)
+)
+
+var (
+	asyncRetryDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pulsar_beam_async_retry_dropped_total",
+		Help: "The number of async messages dropped because the retry queue is full or closed, or the max attempts is reached.",
+	})
+	asyncRetried = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pulsar_beam_async_retried_total",
+		Help: "The number of async message re-publish attempts.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(asyncRetryDropped, asyncRetried)
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "pulsar_beam_async_retry_queue_depth",
+		Help: "The number of async messages waiting in the retry queue.",
+	}, func() float64 {
+		return float64(retryQueue().len())
+	}))
+}
+
+// asyncSendStatusCache keeps the outcome of async sends, key is the PulsarBeamId
+// The cache is bounded and a lookup does not extend the expiry, so polling a status cannot keep it forever.
+var asyncSendStatusCache = util.NewCache(util.CacheOption{
+	TTL:            asyncStatusTTL,
+	CleanInterval:  time.Minute,
+	ExpireCallback: func(key string, value interface{}) {},
+	MaxSize:        asyncStatusCacheSize,
+	FixedTTL:       true,
+})
+
+// GetAsyncSendStatus returns the outcome of an async send by the message's PulsarBeamId
+func GetAsyncSendStatus(beamID string) (model.AsyncSendStatus, bool) {
+	obj, ok := asyncSendStatusCache.Get(beamID)
+	if !ok {
+		return model.AsyncSendStatus{}, false
+	}
+	status, ok := obj.(model.AsyncSendStatus)
+	return status, ok
+}
+
+// setAsyncSendStatus records the outcome of an async send
+func setAsyncSendStatus(item *retryItem, status, errStr string, id pulsar.MessageID) {
+	s := model.AsyncSendStatus{
+		PulsarBeamID: item.beamID,
+		Topic:        item.topic,
+		Status:       status,
+		Attempts:     item.attempts,
+		LastError:    errStr,
+		UpdatedAt:    time.Now(),
+	}
+	if id != nil {
+		s.MessageID = model.MessageIDString(id)
+	}
+	asyncSendStatusCache.Set(item.beamID, s)
+}
+
+// retryItem is a message to be re-published
+type retryItem struct {
+	url      string
+	token    string
+	topic    string
+	schema   pulsar.Schema
+	beamID   string
+	msg      *pulsar.ProducerMessage
+	attempts int
+	next     time.Time
+}
+
+// retryHeap orders the retry items by the time they are due
+type retryHeap []*retryItem
+
+func (h retryHeap) Len() int            { return len(h) }
+func (h retryHeap) Less(i, j int) bool  { return h[i].next.Before(h[j].next) }
+func (h retryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *retryHeap) Push(x interface{}) { *h = append(*h, x.(*retryItem)) }
+func (h *retryHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+// asyncRetryQueue is the bounded retry queue with a single worker
+// The items are re-published in the order they are due, so an item in a long backoff does not hold up the others.
+type asyncRetryQueue struct {
+	items      retryHeap
+	size       int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	send       func(ctx context.Context, item *retryItem) (pulsar.MessageID, error)
+	// wake signals the worker that an item is pushed or the queue is draining
+	wake chan struct{}
+	// sending is true while the worker re-publishes an item
+	sending  bool
+	draining bool
+	drained  chan struct{}
+	closed   bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	sync.Mutex
+}
+
+var (
+	asyncRetry     *asyncRetryQueue
+	asyncRetryOnce sync.Once
+)
+
+// retryQueue returns the retry queue singleton and starts its worker on first use
+func retryQueue() *asyncRetryQueue {
+	asyncRetryOnce.Do(func() {
+		asyncRetry = newAsyncRetryQueue(asyncRetryQueueSize, asyncRetryMinBackoff, asyncRetryMaxBackoff, sendRetryItem)
+	})
+	return asyncRetry
+}
+
+// newAsyncRetryQueue creates a retry queue and starts its worker
+func newAsyncRetryQueue(size int, minBackoff, maxBackoff time.Duration, send func(context.Context, *retryItem) (pulsar.MessageID, error)) *asyncRetryQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &asyncRetryQueue{
+		size:       size,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		send:       send,
+		wake:       make(chan struct{}, 1),
+		drained:    make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// len returns the number of messages waiting in the queue
+func (q *asyncRetryQueue) len() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.items)
+}
+
+// notify wakes up the worker without blocking
+func (q *asyncRetryQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// push enqueues a failed message with backoff, the message is dropped if the queue is full or closed
+func (q *asyncRetryQueue) push(item *retryItem, errStr string) {
+	if item.attempts >= asyncRetryMaxAttempts {
+		asyncRetryDropped.Inc()
+		setAsyncSendStatus(item, model.AsyncSendFailed, errStr, nil)
+		log.Errorf("drop async message %s to topic %s after %d attempts", item.beamID, item.topic, item.attempts)
+		return
+	}
+	item.next = time.Now().Add(asyncRetryBackoff(item.attempts, q.minBackoff, q.maxBackoff))
+
+	q.Lock()
+	reason := ""
+	if q.closed {
+		reason = "retry queue is closed"
+	} else if len(q.items) >= q.size {
+		reason = "retry queue is full"
+	} else {
+		heap.Push(&q.items, item)
+	}
+	q.Unlock()
+
+	if reason != "" {
+		asyncRetryDropped.Inc()
+		setAsyncSendStatus(item, model.AsyncSendDropped, reason, nil)
+		log.Errorf("drop async message %s to topic %s since %s", item.beamID, item.topic, reason)
+		return
+	}
+	setAsyncSendStatus(item, model.AsyncSendRetrying, errStr, nil)
+	q.notify()
+}
+
+// run re-publishes the queued messages when they are due until the queue is closed
+func (q *asyncRetryQueue) run() {
+	defer close(q.done)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		q.Lock()
+		var item *retryItem
+		wait := time.Duration(-1)
+		if len(q.items) > 0 {
+			if wait = time.Until(q.items[0].next); wait <= 0 {
+				item = heap.Pop(&q.items).(*retryItem)
+				q.sending = true
+			}
+		} else if q.draining {
+			q.draining = false
+			close(q.drained)
+		}
+		q.Unlock()
+
+		if item != nil {
+			q.resend(item)
+			q.Lock()
+			q.sending = false
+			q.Unlock()
+			continue
+		}
+
+		var due <-chan time.Time
+		if wait > 0 {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+			due = timer.C
+		}
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-q.wake:
+		case <-due:
+		}
+	}
+}
+
+// resend publishes the message synchronously and pushes it back to the queue on failure
+func (q *asyncRetryQueue) resend(item *retryItem) {
+	item.attempts++
+	asyncRetried.Inc()
+	id, err := q.send(q.ctx, item)
+	if err != nil {
+		q.push(item, err.Error())
+		return
+	}
+	setAsyncSendStatus(item, model.AsyncSendSent, "", id)
+}
+
+// sendRetryItem publishes a retry item to Pulsar
+func sendRetryItem(ctx context.Context, item *retryItem) (pulsar.MessageID, error) {
+	p, err := GetPulsarProducer(item.url, item.token, item.topic, item.schema)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, asyncSendTimeout)
+	defer cancel()
+	return p.Send(ctx, item.msg)
+}
+
+// close drains the queue by re-publishing every queued message without waiting for its backoff,
+// since the messages have been accepted by the clients. The messages left in the queue once the context
+// is done are dropped.
+func (q *asyncRetryQueue) close(ctx context.Context) {
+	q.Lock()
+	if q.closed {
+		q.Unlock()
+		return
+	}
+	now := time.Now()
+	for _, item := range q.items {
+		item.next = now
+	}
+	q.draining = true
+	q.Unlock()
+	q.notify()
+
+	select {
+	case <-q.drained:
+	case <-ctx.Done():
+	}
+	q.Lock()
+	q.closed = true
+	q.Unlock()
+	q.cancel()
+	<-q.done
+
+	q.Lock()
+	defer q.Unlock()
+	if dropped := len(q.items); dropped > 0 {
+		asyncRetryDropped.Add(float64(dropped))
+		for _, item := range q.items {
+			setAsyncSendStatus(item, model.AsyncSendDropped, "retry queue is closed on shutdown", nil)
+		}
+		q.items = nil
+		log.Warnf("drop %d async messages in the retry queue on shutdown", dropped)
+	}
+}
+
+// asyncRetryBackoff is the exponential backoff by the number of attempts
+func asyncRetryBackoff(attempts int, minBackoff, maxBackoff time.Duration) time.Duration {
+	backoff := minBackoff << uint(attempts)
+	if backoff <= 0 || backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
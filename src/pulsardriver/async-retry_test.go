@@ -0,0 +1,122 @@
+package pulsardriver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockSender records the re-published items and fails the first failures attempts of every item
+type mockSender struct {
+	failures int
+	sent     []string
+	sync.Mutex
+}
+
+func (s *mockSender) send(ctx context.Context, item *retryItem) (pulsar.MessageID, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.failures < 0 || item.attempts <= s.failures {
+		return nil, errors.New("broker unavailable")
+	}
+	s.sent = append(s.sent, item.beamID)
+	return pulsar.EarliestMessageID(), nil
+}
+
+func (s *mockSender) sentItems() []string {
+	s.Lock()
+	defer s.Unlock()
+	return append([]string(nil), s.sent...)
+}
+
+func waitForStatus(t *testing.T, beamID, status string) model.AsyncSendStatus {
+	var s model.AsyncSendStatus
+	assert.Eventually(t, func() bool {
+		var ok bool
+		s, ok = GetAsyncSendStatus(beamID)
+		return ok && s.Status == status
+	}, 5*time.Second, 5*time.Millisecond)
+	return s
+}
+
+func TestAsyncRetryThenSuccess(t *testing.T) {
+	sender := &mockSender{failures: 2}
+	q := newAsyncRetryQueue(10, time.Millisecond, 10*time.Millisecond, sender.send)
+	defer q.close(context.Background())
+
+	q.push(&retryItem{topic: "persistent://ten/ns/topic", beamID: "retry-success", attempts: 1}, "timeout")
+	s := waitForStatus(t, "retry-success", model.AsyncSendSent)
+	assert.Equal(t, 3, s.Attempts)
+	assert.Equal(t, model.MessageIDString(pulsar.EarliestMessageID()), s.MessageID)
+	assert.Equal(t, 0, q.len())
+}
+
+func TestAsyncRetryExhausted(t *testing.T) {
+	sender := &mockSender{failures: -1}
+	q := newAsyncRetryQueue(10, time.Millisecond, 10*time.Millisecond, sender.send)
+	defer q.close(context.Background())
+
+	q.push(&retryItem{topic: "persistent://ten/ns/topic", beamID: "retry-exhausted", attempts: 1}, "timeout")
+	s := waitForStatus(t, "retry-exhausted", model.AsyncSendFailed)
+	assert.Equal(t, asyncRetryMaxAttempts, s.Attempts)
+	assert.Equal(t, "broker unavailable", s.LastError)
+	assert.Empty(t, sender.sentItems())
+}
+
+func TestAsyncRetryDueOrder(t *testing.T) {
+	sender := &mockSender{}
+	q := newAsyncRetryQueue(10, 10*time.Millisecond, time.Hour, sender.send)
+	defer q.close(context.Background())
+
+	// the item in a long backoff is queued first but must not block the item due sooner
+	q.push(&retryItem{beamID: "retry-later", attempts: 4}, "timeout")
+	q.push(&retryItem{beamID: "retry-sooner", attempts: 0}, "timeout")
+	waitForStatus(t, "retry-sooner", model.AsyncSendSent)
+	waitForStatus(t, "retry-later", model.AsyncSendSent)
+	assert.Equal(t, []string{"retry-sooner", "retry-later"}, sender.sentItems())
+}
+
+func TestAsyncRetryDrainOnClose(t *testing.T) {
+	sender := &mockSender{}
+	q := newAsyncRetryQueue(10, time.Hour, time.Hour, sender.send)
+	for _, id := range []string{"drain-1", "drain-2", "drain-3"} {
+		q.push(&retryItem{beamID: id, attempts: 1}, "timeout")
+	}
+	assert.Equal(t, 3, q.len())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	q.close(ctx)
+	assert.Equal(t, 0, q.len())
+	assert.ElementsMatch(t, []string{"drain-1", "drain-2", "drain-3"}, sender.sentItems())
+	for _, id := range []string{"drain-1", "drain-2", "drain-3"} {
+		s, ok := GetAsyncSendStatus(id)
+		assert.True(t, ok)
+		assert.Equal(t, model.AsyncSendSent, s.Status)
+	}
+
+	// the queue drops the messages after it is closed
+	q.push(&retryItem{beamID: "drain-closed", attempts: 1}, "timeout")
+	s, _ := GetAsyncSendStatus("drain-closed")
+	assert.Equal(t, model.AsyncSendDropped, s.Status)
+}
+
+func TestAsyncRetryDropOnCloseTimeout(t *testing.T) {
+	sender := &mockSender{failures: -1}
+	q := newAsyncRetryQueue(10, time.Hour, time.Hour, sender.send)
+	q.push(&retryItem{beamID: "drain-timeout", attempts: 1}, "timeout")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	q.close(ctx)
+	assert.Equal(t, 0, q.len())
+	s, _ := GetAsyncSendStatus("drain-timeout")
+	assert.Equal(t, model.AsyncSendDropped, s.Status)
+	assert.Equal(t, 2, s.Attempts)
+}
@@ -0,0 +1,96 @@
+package pulsardriver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/kafkaesque-io/pulsar-beam/src/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// Idempotent producer
+// Pulsar broker deduplication drops a message whose sequence id is not greater than the last
+// sequence id persisted for the same producer name. A named producer per topic assigns an explicit
+// sequence id to every idempotent message, so that a retry with the same sequence id is deduplicated.
+// Deduplication must be enabled on the namespace or the topic.
+// The sequence ids come from a counter of the producer in this process rather than the idempotency key, since
+// broker deduplication requires increasing sequence ids. Therefore a retry is only deduplicated by the broker
+// when it reaches the same beam process before another idempotent message is sent to the topic, and a retry on
+// another replica is published again with a new sequence id.
+
+// idempotentProducerName must be unique for every beam instance connecting to the same topic
+var idempotentProducerName = "pulsar-beam-" + util.AssignString(os.Getenv("IdempotentProducerName"), hostname())
+
+// idempotentProducerSync prevents multiple producers with the same name from being created
+var idempotentProducerSync = &sync.Mutex{}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		log.Errorf("failed to get hostname for the idempotent producer name %v", err)
+		return "idempotent"
+	}
+	return name
+}
+
+// getIdempotentProducer gets the named producer of a topic
+func getIdempotentProducer(pulsarURL, pulsarToken, topic string, schema pulsar.Schema) (*PulsarProducer, pulsar.Producer, error) {
+	idempotentProducerSync.Lock()
+	defer idempotentProducerSync.Unlock()
+
+	key := pulsarURL + pulsarToken + topic + schemaKey(schema) + idempotentProducerName
+	if obj, exists := ProducerCache.Get(key); exists {
+		if driver, ok := obj.(*PulsarProducer); ok {
+			p, err := driver.GetProducer()
+			return driver, p, err
+		}
+	}
+	prod := &PulsarProducer{
+		createdAt: time.Now(),
+		pulsarURL: pulsarURL,
+		token:     pulsarToken,
+		topic:     topic,
+		schema:    schema,
+		name:      idempotentProducerName,
+	}
+	p, err := prod.GetProducer()
+	if err != nil {
+		return nil, nil, err
+	}
+	ProducerCache.Set(key, prod)
+	return prod, p, nil
+}
+
+// nextSequenceID returns the sequence id for a message. A retry reuses its previous sequence id only if
+// no other message has been assigned a sequence id since, otherwise the broker would drop the retry as
+// a duplicate even though the previous attempt may have never been persisted.
+func (c *PulsarProducer) nextSequenceID(previous int64) int64 {
+	c.Lock()
+	defer c.Unlock()
+	if previous >= 0 && previous == c.sequenceID {
+		return previous
+	}
+	c.sequenceID++
+	return c.sequenceID
+}
+
+// SendIdempotentToPulsar sends a message with an explicit sequence id by the named producer of the topic.
+// previousSequenceID is the sequence id of the previous attempt of the same message, or -1 for the first attempt.
+// It returns the message id and the sequence id that a retry should pass in.
+func SendIdempotentToPulsar(url, token, topic string, schema pulsar.Schema, message *pulsar.ProducerMessage, previousSequenceID int64) (pulsar.MessageID, int64, error) {
+	prod, p, err := getIdempotentProducer(url, token, topic, schema)
+	if err != nil {
+		log.Errorf("Failed to create Pulsar idempotent producer err: %v", err)
+		return nil, previousSequenceID, errors.New("Failed to create Pulsar producer")
+	}
+
+	sequenceID := prod.nextSequenceID(previousSequenceID)
+	message.SequenceID = &sequenceID
+	prepareMessage(message)
+	id, err := p.Send(context.Background(), message)
+	return id, sequenceID, err
+}
@@ -1,6 +1,7 @@
 package pulsardriver
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -43,6 +44,21 @@ func GetPulsarClient(pulsarURL, pulsarToken string, reset bool) (pulsar.Client,
 
 }
 
+// Shutdown drains the async retry queue until the context is done, flushes and closes all producers, consumers,
+// and then clients
+func Shutdown(ctx context.Context) {
+	retryQueue().close(ctx)
+	CloseAllProducers()
+	CloseAllConsumers()
+
+	clientSync.Lock()
+	defer clientSync.Unlock()
+	for key, c := range ClientCache {
+		c.Close()
+		delete(ClientCache, key)
+	}
+}
+
 // PulsarClient encapsulates the Pulsar Client object
 type PulsarClient struct {
 	client    pulsar.Client
@@ -20,6 +20,20 @@ var consumerSync = &sync.RWMutex{}
 
 // GetPulsarConsumer gets a Pulsar consumer object
 func GetPulsarConsumer(pulsarURL, pulsarToken, topic, subName, subInitPos, subType, subKey string) (pulsar.Consumer, error) {
+	subscriptionType, err := model.GetSubscriptionType(subType)
+	if err != nil {
+		return nil, err
+	}
+	initPosition, err := model.GetInitialPosition(subInitPos)
+	if err != nil {
+		return nil, err
+	}
+	return GetSubscriptionConsumer(pulsarURL, pulsarToken, topic, subName, initPosition, subscriptionType, 0, 0, subKey)
+}
+
+// GetSubscriptionConsumer gets a Pulsar consumer object with the Pulsar subscription type and initial position
+// The nack redelivery delay and the receiver queue size are the Pulsar client defaults if they are 0.
+func GetSubscriptionConsumer(pulsarURL, pulsarToken, topic, subName string, subInitPos pulsar.SubscriptionInitialPosition, subType pulsar.SubscriptionType, nackDelay time.Duration, receiverQueueSize int, subKey string) (pulsar.Consumer, error) {
 	key := subKey
 	consumerSync.RLock()
 	prod, ok := ConsumerCache[key]
@@ -31,15 +45,10 @@ func GetPulsarConsumer(pulsarURL, pulsarToken, topic, subName, subInitPos, subTy
 		prod.token = pulsarToken
 		prod.topic = topic
 		prod.subscriptionName = subName
-		var err error
-		prod.subscriptionType, err = model.GetSubscriptionType(subType)
-		if err != nil {
-			return nil, err
-		}
-		prod.initPosition, err = model.GetInitialPosition(subInitPos)
-		if err != nil {
-			return nil, err
-		}
+		prod.subscriptionType = subType
+		prod.initPosition = subInitPos
+		prod.nackRedeliveryDelay = nackDelay
+		prod.receiverQueueSize = receiverQueueSize
 		consumerSync.Lock()
 		ConsumerCache[key] = prod
 		consumerSync.Unlock()
@@ -73,18 +82,47 @@ func CancelPulsarConsumer(key string) {
 	}
 }
 
+// ClosePulsarConsumer closes Pulsar consumer and removes from the ConsumerCache
+// Unlike CancelPulsarConsumer, the subscription is always kept so that it can be resumed.
+func ClosePulsarConsumer(key string) {
+	consumerSync.Lock()
+	defer consumerSync.Unlock()
+	c, ok := ConsumerCache[key]
+	if ok {
+		c.Close()
+		delete(ConsumerCache, key)
+	} else {
+		log.Errorf("close consumer failed to locate consumer key %v", key)
+	}
+}
+
+// CloseAllConsumers closes every cached consumer and unsubscribes the non-resumable subscriptions
+func CloseAllConsumers() {
+	consumerSync.Lock()
+	defer consumerSync.Unlock()
+	for key, c := range ConsumerCache {
+		if c.consumer != nil && strings.HasPrefix(c.consumer.Subscription(), model.NonResumable) {
+			util.ReportError(c.consumer.Unsubscribe())
+		}
+		c.Close()
+		delete(ConsumerCache, key)
+	}
+}
+
 // PulsarConsumer encapsulates the Pulsar Consumer object
 type PulsarConsumer struct {
-	consumer         pulsar.Consumer
-	pulsarURL        string
-	token            string
-	topic            string
-	subscriptionName string
-	subscriptionKey  string
-	initPosition     pulsar.SubscriptionInitialPosition
-	subscriptionType pulsar.SubscriptionType
-	createdAt        time.Time
-	lastUsed         time.Time
+	consumer            pulsar.Consumer
+	pulsarURL           string
+	token               string
+	topic               string
+	subscriptionName    string
+	subscriptionKey     string
+	initPosition        pulsar.SubscriptionInitialPosition
+	subscriptionType    pulsar.SubscriptionType
+	nackRedeliveryDelay time.Duration
+	receiverQueueSize   int
+	createdAt           time.Time
+	lastUsed            time.Time
 	sync.Mutex
 }
 
@@ -110,6 +148,8 @@ func (c *PulsarConsumer) GetConsumer() (pulsar.Consumer, error) {
 		SubscriptionName:            c.subscriptionName,
 		SubscriptionInitialPosition: c.initPosition,
 		Type:                        c.subscriptionType,
+		NackRedeliveryDelay:         c.nackRedeliveryDelay,
+		ReceiverQueueSize:           c.receiverQueueSize,
 	})
 	if err != nil {
 		log.Errorf("consumer subscribe error:%s\n", err.Error())
@@ -139,3 +179,16 @@ func (c *PulsarConsumer) Reconnect() (pulsar.Consumer, error) {
 	c.Close()
 	return c.GetConsumer()
 }
+
+// GetCachedConsumer returns the consumer held in the ConsumerCache, false if it is absent or closed
+func GetCachedConsumer(key string) (pulsar.Consumer, bool) {
+	consumerSync.RLock()
+	c, ok := ConsumerCache[key]
+	consumerSync.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	c.Lock()
+	defer c.Unlock()
+	return c.consumer, c.consumer != nil
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
 	"github.com/kafkaesque-io/pulsar-beam/src/util"
 	log "github.com/sirupsen/logrus"
 )
@@ -27,9 +28,9 @@ var ProducerCache = util.NewCache(util.CacheOption{
 	},
 })
 
-// GetPulsarProducer gets a Pulsar producer object
-func GetPulsarProducer(pulsarURL, pulsarToken, topic string) (pulsar.Producer, error) {
-	key := pulsarURL + pulsarToken + topic
+// GetPulsarProducer gets a Pulsar producer object, the schema is optional
+func GetPulsarProducer(pulsarURL, pulsarToken, topic string, schema pulsar.Schema) (pulsar.Producer, error) {
+	key := pulsarURL + pulsarToken + topic + schemaKey(schema)
 	obj, exists := ProducerCache.Get(key)
 	if exists {
 		if driver, ok := obj.(*PulsarProducer); ok {
@@ -41,6 +42,7 @@ func GetPulsarProducer(pulsarURL, pulsarToken, topic string) (pulsar.Producer, e
 		pulsarURL: pulsarURL,
 		token:     pulsarToken,
 		topic:     topic,
+		schema:    schema,
 	}
 	p, err := prod.GetProducer()
 	if err != nil {
@@ -56,53 +58,129 @@ func GetPulsarProducer(pulsarURL, pulsarToken, topic string) (pulsar.Producer, e
 	return p, nil
 }
 
+// CloseAllProducers flushes and closes every cached producer
+func CloseAllProducers() {
+	ProducerCache.Close()
+}
+
 // PulsarProducer encapsulates the Pulsar Producer object
 type PulsarProducer struct {
 	producer  pulsar.Producer
 	pulsarURL string
 	token     string
 	topic     string
-	createdAt time.Time
-	lastUsed  time.Time
+	schema    pulsar.Schema
+	// name is only specified for a producer that assigns sequence ids explicitly
+	name       string
+	sequenceID int64
+	createdAt  time.Time
+	lastUsed   time.Time
 	sync.Mutex
 }
 
 // SendToPulsar sends data to a Pulsar producer.
 func SendToPulsar(url, token, topic string, data []byte, async bool) error {
-	p, err := GetPulsarProducer(url, token, topic)
+	_, err := SendMessageToPulsar(url, token, topic, nil, &pulsar.ProducerMessage{Payload: data}, async)
+	return err
+}
+
+// SendMessageToPulsar sends a message with optional key, properties, event time, and delivery time to a Pulsar producer.
+// The payload must be encoded already if the topic has a schema.
+// It returns the message id in sync mode, and nil message id in async mode.
+func SendMessageToPulsar(url, token, topic string, schema pulsar.Schema, message *pulsar.ProducerMessage, async bool) (pulsar.MessageID, error) {
+	p, err := GetPulsarProducer(url, token, topic, schema)
 	if err != nil {
 		log.Errorf("Failed to create Pulsar produce err: %v", err)
-		return errors.New("Failed to create Pulsar producer")
+		return nil, errors.New("Failed to create Pulsar producer")
 	}
 
 	ctx := context.Background()
-
-	id, err := util.NewUUID()
-	if err != nil {
-		// this is very bad if happens
-		log.Warnf("NewUUID generation error %v", err)
-		id = strconv.FormatInt(time.Now().Unix(), 10)
-	}
-	prop := map[string]string{"PulsarBeamId": id}
-	//TODO: add cluster origin and maybe other properties
-
-	message := pulsar.ProducerMessage{
-		Payload:    data,
-		EventTime:  time.Now(),
-		Properties: prop,
-	}
+	prepareMessage(message)
 
 	if async {
-		p.SendAsync(ctx, &message, func(messageId pulsar.MessageID, msg *pulsar.ProducerMessage, err error) {
+		item := &retryItem{
+			url:    url,
+			token:  token,
+			topic:  topic,
+			schema: schema,
+			beamID: message.Properties["PulsarBeamId"],
+			msg:    message,
+		}
+		setAsyncSendStatus(item, model.AsyncSendPending, "", nil)
+		p.SendAsync(ctx, message, func(messageId pulsar.MessageID, msg *pulsar.ProducerMessage, err error) {
+			item.attempts++
 			if err != nil {
 				log.Warnf("send to Pulsar err %v", err)
-				// TODO: push to a queue for retry
+				retryQueue().push(item, err.Error())
+				return
 			}
+			setAsyncSendStatus(item, model.AsyncSendSent, "", messageId)
 		})
-		return nil
+		return nil, nil
 	}
-	_, err = p.Send(ctx, &message)
-	return err
+	return p.Send(ctx, message)
+}
+
+// SendBatchToPulsar sends a batch of messages to a Pulsar producer asynchronously and waits for all the results.
+// It returns the message id or the error of every message in the same order as the messages.
+func SendBatchToPulsar(url, token, topic string, schema pulsar.Schema, msgs []*pulsar.ProducerMessage) ([]pulsar.MessageID, []error, error) {
+	p, err := GetPulsarProducer(url, token, topic, schema)
+	if err != nil {
+		log.Errorf("Failed to create Pulsar produce err: %v", err)
+		return nil, nil, errors.New("Failed to create Pulsar producer")
+	}
+
+	ids := make([]pulsar.MessageID, len(msgs))
+	errs := make([]error, len(msgs))
+	var wg sync.WaitGroup
+	for i, msg := range msgs {
+		prepareMessage(msg)
+		wg.Add(1)
+		index := i
+		p.SendAsync(context.Background(), msg, func(messageID pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+			ids[index] = messageID
+			errs[index] = err
+			wg.Done()
+		})
+	}
+	// send the batch right away rather than waiting for the batching max publish delay
+	if err := p.Flush(); err != nil {
+		log.Warnf("failed to flush producer of topic %s err %v", topic, err)
+	}
+	wg.Wait()
+	return ids, errs, nil
+}
+
+// schemaKey identifies the producers of the same topic with different schemas
+func schemaKey(schema pulsar.Schema) string {
+	if schema == nil || schema.GetSchemaInfo() == nil {
+		return ""
+	}
+	info := schema.GetSchemaInfo()
+	return strconv.Itoa(int(info.Type)) + info.Schema
+}
+
+// prepareMessage sets the PulsarBeamId property, and the event time to now if it is absent
+func prepareMessage(msg *pulsar.ProducerMessage) {
+	if msg.Properties == nil {
+		msg.Properties = make(map[string]string)
+	}
+	//TODO: add cluster origin and maybe other properties
+	msg.Properties["PulsarBeamId"] = newBeamID()
+	if msg.EventTime.IsZero() {
+		msg.EventTime = time.Now()
+	}
+}
+
+// newBeamID generates a unique PulsarBeamId property of a message
+func newBeamID() string {
+	id, err := util.NewUUID()
+	if err != nil {
+		// this is very bad if happens
+		log.Warnf("NewUUID generation error %v", err)
+		id = strconv.FormatInt(time.Now().Unix(), 10)
+	}
+	return id
 }
 
 // GetProducer acquires a new pulsar producer
@@ -119,13 +197,17 @@ func (c *PulsarProducer) GetProducer() (pulsar.Producer, error) {
 		return nil, err
 	}
 	p, err := driver.CreateProducer(pulsar.ProducerOptions{
-		Topic: c.topic,
+		Topic:  c.topic,
+		Name:   c.name,
+		Schema: c.schema,
 	})
 	if err != nil {
 		return nil, err
 	}
 
 	c.producer = p
+	// the broker returns the last sequence id of a named producer if deduplication is enabled
+	c.sequenceID = p.LastSequenceID()
 	return p, nil
 }
 
@@ -134,11 +216,14 @@ func (c *PulsarProducer) UpdateTime() {
 	c.lastUsed = time.Now()
 }
 
-// Close closes the Pulsar client
+// Close flushes pending messages and closes the Pulsar producer
 func (c *PulsarProducer) Close() {
 	c.Lock()
 	defer c.Unlock()
 	if c.producer != nil {
+		if err := c.producer.Flush(); err != nil {
+			log.Warnf("failed to flush producer of topic %s err %v", c.topic, err)
+		}
 		c.producer.Close()
 		c.producer = nil
 	}
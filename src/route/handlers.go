@@ -1,6 +1,7 @@
 package route
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,7 +9,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 	"compress/gzip"
 
 	"github.com/apache/pulsar-client-go/pulsar"
@@ -81,19 +84,7 @@ type InfoRichMessage struct {
 
 // ReceiveHandler - the message receiver handler
 func ReceiveHandler(w http.ResponseWriter, r *http.Request) {
-	var b []byte
-	var err error
-	if r.Header.Get("Content-Encoding") == "gzip" {
-		g, gerr := gzip.NewReader(r.Body)
-		if gerr != nil {
-			util.ResponseErrorJSON(gerr, w, http.StatusInternalServerError)
-			return
-		}
-		b, err = ioutil.ReadAll(g)
-	} else {
-		b, err = ioutil.ReadAll(r.Body)
-	}
-	defer r.Body.Close()
+	b, err := readRequestBody(r)
 	if err != nil {
 		util.ResponseErrorJSON(err, w, http.StatusInternalServerError)
 		return
@@ -128,14 +119,191 @@ func ReceiveHandler(w http.ResponseWriter, r *http.Request) {
 	topicFN = util.AssignString(topic, topicFN) // header topicFn overwrites topic specified in the routes
 	log.Infof("topicFN %s pulsarURL %s", topicFN, pulsarURL)
 
+	message, err := ProducerMessageFromHTTPParts(&r.Header, r.URL.Query(), b)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
+	schema := getTopicSchema(topicFN, pulsarURL)
+	if message.Payload, err = schema.Encode(message.Payload); err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
+
 	pulsarAsync := r.URL.Query().Get("mode") == "async"
-	err = pulsardriver.SendToPulsar(pulsarURL, token, topicFN, b, pulsarAsync)
+	if key := r.Header.Get(IdempotencyKeyHeader); key != "" {
+		if pulsarAsync {
+			util.ResponseErrorJSON(errors.New("Idempotency-Key is not supported in async mode"), w, http.StatusUnprocessableEntity)
+			return
+		}
+		if err := validateIdempotencyKey(key); err != nil {
+			util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+			return
+		}
+		sendIdempotent(w, getIdempotencyEntry(pulsarURL, topicFN, key), pulsarURL, token, topicFN, schema.PulsarSchema(), message)
+		return
+	}
+
+	start := time.Now()
+	id, err := pulsardriver.SendMessageToPulsar(pulsarURL, token, topicFN, schema.PulsarSchema(), message, pulsarAsync)
 	if err != nil {
 		util.ResponseErrorJSON(err, w, http.StatusServiceUnavailable)
 		return
 	}
+
+	data, err := json.Marshal(model.NewFirehoseResponse(id, message.Properties["PulsarBeamId"], time.Since(start)))
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
-	return
+	w.Write(data)
+}
+
+// sendIdempotent publishes a message with the sequence id of its idempotency key, or replays the response
+// of a previous successful publish with the same key. Requests with the same key are serialized.
+func sendIdempotent(w http.ResponseWriter, entry *idempotencyEntry, pulsarURL, token, topicFN string, schema pulsar.Schema, message *pulsar.ProducerMessage) {
+	entry.Lock()
+	defer entry.Unlock()
+	if entry.response != nil {
+		entry.replay(w)
+		return
+	}
+
+	start := time.Now()
+	id, sequenceID, err := pulsardriver.SendIdempotentToPulsar(pulsarURL, token, topicFN, schema, message, entry.sequenceID)
+	entry.sequenceID = sequenceID
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusServiceUnavailable)
+		return
+	}
+
+	data, err := json.Marshal(model.NewFirehoseResponse(id, message.Properties["PulsarBeamId"], time.Since(start)))
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusInternalServerError)
+		return
+	}
+	entry.response = data
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// ReceiveBatchHandler - the batch message receiver handler
+// The body is either a JSON array or newline delimited JSON of messages.
+func ReceiveBatchHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := readRequestBody(r)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusInternalServerError)
+		return
+	}
+	token, topic, pulsarURL, err := util.ReceiverHeader(util.AllowedPulsarURLs, &r.Header)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnauthorized)
+		return
+	}
+
+	topicFN, err2 := GetTopicFnFromRoute(mux.Vars(r))
+	if topic == "" && err2 != nil {
+		util.ResponseErrorJSON(err2, w, http.StatusUnprocessableEntity)
+		return
+	}
+	topicFN = util.AssignString(topic, topicFN)
+
+	msgs, err := model.ParseFirehoseMessages(b)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
+	log.Infof("topicFN %s pulsarURL %s batch size %d", topicFN, pulsarURL, len(msgs))
+
+	schema := getTopicSchema(topicFN, pulsarURL)
+	producerMsgs := make([]*pulsar.ProducerMessage, len(msgs))
+	for i, msg := range msgs {
+		payload, err := schema.Encode(msg.Data())
+		if err != nil {
+			util.ResponseErrorJSON(fmt.Errorf("message %d %v", i, err), w, http.StatusUnprocessableEntity)
+			return
+		}
+		producerMsgs[i] = &pulsar.ProducerMessage{
+			Payload:    payload,
+			Key:        msg.Key,
+			Properties: msg.Properties,
+		}
+		if msg.EventTime != nil {
+			producerMsgs[i].EventTime = *msg.EventTime
+		}
+	}
+	ids, errs, err := pulsardriver.SendBatchToPulsar(pulsarURL, token, topicFN, schema.PulsarSchema(), producerMsgs)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusServiceUnavailable)
+		return
+	}
+
+	res := model.FirehoseBatchResponse{Results: make([]model.FirehoseResult, len(msgs))}
+	for i := range msgs {
+		res.Results[i].Index = i
+		res.Results[i].PulsarBeamID = producerMsgs[i].Properties["PulsarBeamId"]
+		if errs[i] != nil {
+			res.Results[i].Error = errs[i].Error()
+			res.Failed++
+		} else {
+			res.Results[i].MessageID = model.MessageIDString(ids[i])
+			res.Succeeded++
+		}
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	switch {
+	case res.Failed == 0:
+		w.WriteHeader(http.StatusOK)
+	case res.Succeeded == 0:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	default:
+		w.WriteHeader(http.StatusMultiStatus)
+	}
+	w.Write(data)
+}
+
+// AsyncSendStatusHandler looks up the outcome of a message sent in async mode by its PulsarBeamId
+func AsyncSendStatusHandler(w http.ResponseWriter, r *http.Request) {
+	beamID := mux.Vars(r)["pulsarBeamId"]
+	status, ok := pulsardriver.GetAsyncSendStatus(beamID)
+	if !ok {
+		util.ResponseErrorJSON(fmt.Errorf("async send %s not found", beamID), w, http.StatusNotFound)
+		return
+	}
+	if !VerifySubjectBasedOnTopic(status.Topic, r.Header.Get("injectedSubs"), ExtractEvalTenant) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	resJSON, err := json.Marshal(status)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusInternalServerError)
+	} else {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Write(resJSON)
+	}
+}
+
+// readRequestBody reads the request body that can be gzip compressed
+func readRequestBody(r *http.Request) ([]byte, error) {
+	defer r.Body.Close()
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		g, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(g)
+	}
+	return ioutil.ReadAll(r.Body)
 }
 
 // recoverHandler a function recovers from panic
@@ -148,6 +316,8 @@ func recoverHandler(r *http.Request) {
 }
 
 // PollHandler polls messages from a Pulsar topic.
+// A long poll with waitMs replies as soon as the first message arrives. Messages polled with autoAck=false on a
+// durable subscription are acknowledged once the client confirms them by the ack message ids of the next poll.
 func PollHandler(w http.ResponseWriter, r *http.Request) {
 	defer recoverHandler(r)
 
@@ -158,13 +328,15 @@ func PollHandler(w http.ResponseWriter, r *http.Request) {
 		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
 		return
 	}
+	opts, err := pollOptions(params, subName)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
-	size := util.QueryParamInt(params, "batchSize", 10)
-	perMessageTimeoutMs := util.QueryParamInt(params, "perMessageTimeoutMs", 300)
-
-	// subscription initial position is always set to earliest since this is short poll
-	msgs, err := broker.PollBatchMessages(pulsarURL, token, topicFN, subName, subType, size, perMessageTimeoutMs)
+	// subscription initial position is always set to earliest
+	msgs, err := broker.PollBatchMessages(r.Context(), pulsarURL, token, topicFN, subName, subType, opts, getTopicSchema(topicFN, pulsarURL))
 	if err != nil {
 		util.ResponseErrorJSON(err, w, http.StatusInternalServerError)
 		return
@@ -185,6 +357,8 @@ func PollHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // SSEHandler is the HTTP SSE handler
+// A message is acknowledged once it is written to the stream. A client reconnecting with the Last-Event-ID header
+// resumes from the event after the last one it received by a reader instead of the subscription.
 func SSEHandler(w http.ResponseWriter, r *http.Request) {
 	defer recoverHandler(r)
 
@@ -196,6 +370,26 @@ func SSEHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	opts, err := parseSSEOptions(params)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
+	filter, err := model.ParseFilter(params.Get("filter"))
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	// the query parameter is for clients that cannot set the header, such as EventSource polyfills
+	var lastEventID pulsar.MessageID
+	if str := util.AssignString(r.Header.Get("Last-Event-ID"), params.Get("lastEventId")); str != "" {
+		if lastEventID, err = model.ParseMessageID(str); err != nil {
+			util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
 	// Make sure that the writer supports flushing.
 	flusher, ok := w.(http.Flusher)
 	if !ok {
@@ -203,11 +397,6 @@ func SSEHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*") // allow connection from different domain
-
 	client, consumer, err := broker.GetPulsarClientConsumer(pulsarURL, token, topicFN, subName, subType, subInitPos)
 	if err != nil {
 		util.ResponseErrorJSON(err, w, http.StatusInternalServerError)
@@ -218,21 +407,70 @@ func SSEHandler(w http.ResponseWriter, r *http.Request) {
 	if strings.HasPrefix(subName, model.NonResumable) {
 		defer consumer.Unsubscribe()
 	}
+	// a reconnect resumes the subscription from the last event, the events up to it are skipped and acknowledged
+	if lastEventID != nil {
+		if err = consumer.Seek(lastEventID); err != nil {
+			util.ResponseErrorJSON(fmt.Errorf("failed to resume from the last event id error %v", err), w, http.StatusInternalServerError)
+			return
+		}
+	}
 
-	consumChan := consumer.Chan()
-	for {
-		select {
-		case msg := <-consumChan:
-			// log.Infof("received message %s on topic %s", string(msg.Payload()), topicFN)
-			consumer.Ack(msg)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*") // allow connection from different domain
+
+	keepAlive, retry := sseTimings(util.GetConfig())
+	if retry > 0 {
+		fmt.Fprintf(w, "retry: %d\n\n", retry.Milliseconds())
+	}
+	flusher.Flush()
 
-			// ledgerId, entryId, batchId, partitionIndex, reserved, consumerId
-			fmt.Fprintf(w, strings.Replace(fmt.Sprintf("id: %v\n", msg.Message.ID()), "&", "", 1))
-			fmt.Fprintf(w, "data: %s\n\n", msg.Payload())
+	schema := getTopicSchema(topicFN, pulsarURL)
+	ctx := r.Context()
+	for {
+		var recvCtx context.Context
+		var cancel context.CancelFunc
+		if keepAlive > 0 {
+			recvCtx, cancel = context.WithTimeout(ctx, keepAlive)
+		} else {
+			recvCtx, cancel = context.WithCancel(ctx)
+		}
+		msg, err := consumer.Receive(recvCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		} else if err != nil && recvCtx.Err() == context.DeadlineExceeded {
+			// a comment line keeps the idle connection open through proxies
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
 			flusher.Flush()
-		case <-r.Context().Done():
+			continue
+		} else if err != nil {
+			log.Errorf("SSE failed to receive message on topic %s error %v", topicFN, err)
 			return
 		}
+
+		if lastEventID != nil {
+			if !sentBefore(msg.ID(), lastEventID) {
+				lastEventID = nil
+			} else {
+				consumer.Ack(msg)
+				continue
+			}
+		}
+		payload := broker.DecodePayload(schema, msg)
+		if broker.Filtered(filter, broker.SSEConsumer, msg, payload) {
+			consumer.Ack(msg)
+			continue
+		}
+		if err := opts.writeEvent(w, msg, payload); err != nil {
+			// the message is not acknowledged and will be redelivered to the subscription
+			return
+		}
+		flusher.Flush()
+		consumer.Ack(msg)
 	}
 }
 
@@ -266,6 +504,47 @@ func GetTopicHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// GetWebhookStatusHandler gets the delivery status of a topic's webhooks
+func GetWebhookStatusHandler(w http.ResponseWriter, r *http.Request) {
+	topicKey, err := GetTopicKey(r)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	doc, err := singleDb.GetByKey(topicKey)
+	if err != nil {
+		log.Errorf("get topic error %v", err)
+		util.ResponseErrorJSON(err, w, http.StatusNotFound)
+		return
+	}
+	if !VerifySubjectBasedOnTopic(doc.TopicFullName, r.Header.Get("injectedSubs"), ExtractEvalTenant) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	states := make([]model.WebhookState, 0, len(doc.Webhooks))
+	for _, wh := range doc.Webhooks {
+		state := model.WebhookState{
+			URL:           wh.URL,
+			Subscription:  wh.Subscription,
+			WebhookStatus: wh.WebhookStatus,
+		}
+		if stats, err := singleDb.GetWebhookStats(broker.SubscriptionKey(doc.Key, wh)); err == nil {
+			state.Stats = stats
+		}
+		states = append(states, state)
+	}
+
+	resJSON, err := json.Marshal(states)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusInternalServerError)
+	} else {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Write(resJSON)
+	}
+}
+
 // UpdateTopicHandler creates or updates a topic
 func UpdateTopicHandler(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
@@ -289,11 +568,22 @@ func UpdateTopicHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the secrets of the stored topic can be submitted back in the encrypted form
+	stored, err := singleDb.GetByTopic(doc.TopicFullName, doc.PulsarURL)
+	if err != nil {
+		stored = nil
+	}
+	if err = model.EncryptWebhookSecrets(&doc, stored); err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
+
 	id, err := singleDb.Update(&doc)
 	if err != nil {
 		util.ResponseErrorJSON(err, w, http.StatusConflict)
 		return
 	}
+	evictTopicSchema(doc.TopicFullName, doc.PulsarURL)
 	if len(id) > 1 {
 		savedDoc, err := singleDb.GetByKey(id)
 		if err != nil {
@@ -337,6 +627,7 @@ func DeleteTopicHandler(w http.ResponseWriter, r *http.Request) {
 		util.ResponseErrorJSON(err, w, http.StatusNotFound)
 		return
 	}
+	evictTopicSchema(doc.TopicFullName, doc.PulsarURL)
 	resJSON, err := json.Marshal(deletedKey)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -460,6 +751,76 @@ func ConsumerParams(params url.Values) (subName string, subInitPos pulsar.Subscr
 	return subName, subInitPos, subType, nil
 }
 
+// the header of a message property in the name:value format, it can be repeated
+const propertyHeader = "PulsarProperty"
+
+// ProducerMessageFromHTTPParts builds a Pulsar producer message with the optional key, ordering key,
+// properties, event time, and delivery time specified in the headers or query parameters.
+// A header takes precedence over the query parameter.
+func ProducerMessageFromHTTPParts(h *http.Header, params url.Values, payload []byte) (*pulsar.ProducerMessage, error) {
+	message := &pulsar.ProducerMessage{
+		Payload:     payload,
+		Key:         util.AssignString(h.Get("PulsarKey"), params.Get("key")),
+		OrderingKey: util.AssignString(h.Get("PulsarOrderingKey"), params.Get("orderingKey")),
+		Properties:  make(map[string]string),
+	}
+
+	// the property name is carried in the value since header names are canonicalized by net/http,
+	// query parameter property=name:value and header PulsarProperty:name:value can be repeated
+	for _, p := range append(params["property"], h.Values(propertyHeader)...) {
+		kv := strings.SplitN(p, ":", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid property %s, the format is name:value", p)
+		}
+		message.Properties[kv[0]] = kv[1]
+	}
+	for name := range *h {
+		if len(name) > len(propertyHeader) && strings.EqualFold(name[:len(propertyHeader)+1], propertyHeader+"-") {
+			return nil, fmt.Errorf("unsupported header %s, a property is set by the header %s in the name:value format", name, propertyHeader)
+		}
+	}
+
+	var err error
+	if str := util.AssignString(h.Get("PulsarEventTime"), params.Get("eventTime")); str != "" {
+		if message.EventTime, err = parseTime(str); err != nil {
+			return nil, fmt.Errorf("invalid event time %s", str)
+		}
+	}
+
+	deliverAfter := util.AssignString(h.Get("PulsarDeliverAfter"), params.Get("deliverAfter"))
+	deliverAt := util.AssignString(h.Get("PulsarDeliverAt"), params.Get("deliverAt"))
+	if deliverAfter != "" && deliverAt != "" {
+		return nil, fmt.Errorf("deliver after and deliver at cannot be both specified")
+	}
+	if deliverAfter != "" {
+		if message.DeliverAfter, err = parseDuration(deliverAfter); err != nil || message.DeliverAfter < 0 {
+			return nil, fmt.Errorf("invalid deliver after %s", deliverAfter)
+		}
+	}
+	if deliverAt != "" {
+		if message.DeliverAt, err = parseTime(deliverAt); err != nil {
+			return nil, fmt.Errorf("invalid deliver at %s", deliverAt)
+		}
+	}
+	return message, nil
+}
+
+// parseTime parses either RFC3339 format or unix epoch time in milliseconds
+func parseTime(str string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return time.Unix(0, ms*int64(time.Millisecond)), nil
+	}
+	return time.Parse(time.RFC3339, str)
+}
+
+// parseDuration parses either a duration string such as 10s or milliseconds
+func parseDuration(str string) (time.Duration, error) {
+	if ms, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	return time.ParseDuration(str)
+}
+
 // ConsumerConfigFromHTTPParts returns configuration parameters required to generate Pulsar Client and Consumer
 func ConsumerConfigFromHTTPParts(allowedClusters []string, h *http.Header, vars map[string]string, params url.Values) (token, topicFN, pulsarURL, subName string, subInitPos pulsar.SubscriptionInitialPosition, subType pulsar.SubscriptionType, err error) {
 	token, _, pulsarURL, err = util.ReceiverHeader(allowedClusters, h)
@@ -0,0 +1,82 @@
+package route
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kafkaesque-io/pulsar-beam/src/util"
+)
+
+// Idempotent publish
+// A firehose request with an Idempotency-Key header is published with an explicit sequence id by a named producer,
+// so that the broker deduplicates a retried message. The response of a successful publish is cached by the key
+// until the TTL expires, and it is returned for any repeated request with the same key without publishing again.
+// Both the response cache and the sequence ids are kept in this process, so the deduplication only holds for the
+// requests with the same key served by the same beam process.
+
+const (
+	// IdempotencyKeyHeader is the request header of the idempotency key
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on a response replayed from the idempotency cache
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+var idempotencyKeyTTL = time.Duration(util.GetEnvInt("IdempotencyKeyTTL", 86400)) * time.Second
+
+// idempotencyCache keeps the idempotency entries, key is the pulsar URL, topic and idempotency key
+var idempotencyCache = util.NewCache(util.CacheOption{
+	TTL:            idempotencyKeyTTL,
+	CleanInterval:  time.Minute,
+	ExpireCallback: func(key string, value interface{}) {},
+})
+
+// idempotencySync guards the creation of idempotency entries
+var idempotencySync = &sync.Mutex{}
+
+// idempotencyEntry serializes the requests with the same key and keeps the sequence id and the response
+type idempotencyEntry struct {
+	sequenceID int64
+	response   []byte
+	sync.Mutex
+}
+
+// validateIdempotencyKey checks the key is printable ASCII within the max length
+func validateIdempotencyKey(key string) error {
+	if len(key) > maxIdempotencyKeyLength {
+		return errors.New("Idempotency-Key exceeds the max length of 255")
+	}
+	for _, c := range key {
+		if c < 0x20 || c > 0x7e {
+			return errors.New("Idempotency-Key must be printable ASCII characters")
+		}
+	}
+	return nil
+}
+
+// getIdempotencyEntry gets or creates the entry of an idempotency key
+func getIdempotencyEntry(pulsarURL, topic, key string) *idempotencyEntry {
+	idempotencySync.Lock()
+	defer idempotencySync.Unlock()
+
+	cacheKey := pulsarURL + "|" + topic + "|" + key
+	if obj, ok := idempotencyCache.Get(cacheKey); ok {
+		if entry, ok := obj.(*idempotencyEntry); ok {
+			return entry
+		}
+	}
+	entry := &idempotencyEntry{sequenceID: -1}
+	idempotencyCache.Set(cacheKey, entry)
+	return entry
+}
+
+// replay writes the cached response
+func (e *idempotencyEntry) replay(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(http.StatusOK)
+	w.Write(e.response)
+}
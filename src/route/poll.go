@@ -0,0 +1,109 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kafkaesque-io/pulsar-beam/src/broker"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/kafkaesque-io/pulsar-beam/src/util"
+)
+
+const (
+	// the max wait time of a long poll
+	maxPollWaitMs = 30000
+
+	// the max visibility timeout of a polled message
+	maxVisibilityTimeoutMs = 12 * 60 * 60 * 1000
+
+	// the max number of receipt handles in an ack request
+	maxAckReceiptHandles = 1000
+)
+
+var defaultVisibilityTimeoutMs = util.GetEnvInt("PollVisibilityTimeout", 30) * 1000
+
+// pollOptions parses the poll query parameters
+func pollOptions(params url.Values, subName string) (broker.PollOptions, error) {
+	opts := broker.PollOptions{
+		Size:              util.QueryParamInt(params, "batchSize", 10),
+		PerMessageTimeout: time.Duration(util.QueryParamInt(params, "perMessageTimeoutMs", 300)) * time.Millisecond,
+		Wait:              time.Duration(util.QueryParamInt(params, "waitMs", 0)) * time.Millisecond,
+		AutoAck:           util.StringToBool(util.QueryParamString(params, "autoAck", "true")),
+		VisibilityTimeout: time.Duration(util.QueryParamInt(params, "visibilityTimeoutMs", defaultVisibilityTimeoutMs)) * time.Millisecond,
+		Acks:              params["ack"],
+	}
+	if opts.Size < 1 {
+		return opts, errors.New("batchSize must be a positive number")
+	}
+	filter, err := model.ParseFilter(params.Get("filter"))
+	if err != nil {
+		return opts, err
+	}
+	opts.Filter = filter
+	if opts.Wait < 0 || opts.Wait > maxPollWaitMs*time.Millisecond {
+		return opts, fmt.Errorf("waitMs must be between 0 and %d", maxPollWaitMs)
+	}
+	if opts.VisibilityTimeout <= 0 || opts.VisibilityTimeout > maxVisibilityTimeoutMs*time.Millisecond {
+		return opts, fmt.Errorf("visibilityTimeoutMs must be between 1 and %d", maxVisibilityTimeoutMs)
+	}
+	if strings.HasPrefix(subName, model.NonResumable) && (!opts.AutoAck || len(opts.Acks) > 0) {
+		return opts, errors.New("SubscriptionName is required to acknowledge messages by receipt handles")
+	}
+	return opts, nil
+}
+
+// AckHandler acknowledges the messages polled with autoAck=false by their receipt handles
+func AckHandler(w http.ResponseWriter, r *http.Request) {
+	settlePolledMessages(w, r, true)
+}
+
+// NackHandler negatively acknowledges the messages polled with autoAck=false by their receipt handles,
+// so that they are redelivered to the subscription without waiting for the visibility timeout
+func NackHandler(w http.ResponseWriter, r *http.Request) {
+	settlePolledMessages(w, r, false)
+}
+
+func settlePolledMessages(w http.ResponseWriter, r *http.Request, ack bool) {
+	defer recoverHandler(r)
+
+	params := r.URL.Query()
+	token, topicFN, pulsarURL, subName, _, _, err := ConsumerConfigFromHTTPParts(util.AllowedPulsarURLs, &r.Header, mux.Vars(r), params)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
+	if strings.HasPrefix(subName, model.NonResumable) {
+		util.ResponseErrorJSON(errors.New("SubscriptionName is required"), w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	body, err := readRequestBody(r)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusBadRequest)
+		return
+	}
+	var req model.AckRequest
+	if err = json.Unmarshal(body, &req); err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
+	if len(req.ReceiptHandles) == 0 || len(req.ReceiptHandles) > maxAckReceiptHandles {
+		util.ResponseErrorJSON(fmt.Errorf("receiptHandles must have 1 to %d receipt handles", maxAckReceiptHandles), w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	data, err := json.Marshal(broker.AckPolledMessages(pulsarURL, token, topicFN, subName, req.ReceiptHandles, ack))
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
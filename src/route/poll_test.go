@@ -0,0 +1,21 @@
+package route
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPollSubscriptionType(t *testing.T) {
+	params := url.Values{}
+	_, _, subType, err := ConsumerParams(params)
+	assert.Nil(t, err)
+	assert.Equal(t, pulsar.Exclusive, subType)
+
+	params.Set("SubscriptionType", "shared")
+	_, _, subType, err = ConsumerParams(params)
+	assert.Nil(t, err)
+	assert.Equal(t, pulsar.Shared, subType)
+}
@@ -0,0 +1,100 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kafkaesque-io/pulsar-beam/src/broker"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/kafkaesque-io/pulsar-beam/src/util"
+)
+
+// the max number of messages in a page read by a reader
+const maxReadBatchSize = 1000
+
+// ReadHandler pages through a topic by a reader without creating a subscription, so that it does not
+// leave a cursor behind or affect the backlog. A page is continued by the cursor of the previous page.
+func ReadHandler(w http.ResponseWriter, r *http.Request) {
+	defer recoverHandler(r)
+
+	token, _, pulsarURL, err := util.ReceiverHeader(util.AllowedPulsarURLs, &r.Header)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnauthorized)
+		return
+	}
+	topicFN, err := GetTopicFnFromRoute(mux.Vars(r))
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
+	params := r.URL.Query()
+	opts, err := readOptions(params)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	msgs, err := broker.ReadMessages(r.Context(), pulsarURL, token, topicFN, opts, getTopicSchema(topicFN, pulsarURL))
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusInternalServerError)
+		return
+	}
+	if msgs.Cursor == "" {
+		// the same cursor continues an empty page once new messages arrive
+		msgs.Cursor = params.Get("cursor")
+	}
+
+	data, err := json.Marshal(msgs)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// readOptions parses the reader query parameters, only one of cursor, startMessageId, and startTime can be specified
+func readOptions(params url.Values) (broker.ReadOptions, error) {
+	opts := broker.ReadOptions{
+		Size:              util.QueryParamInt(params, "batchSize", 10),
+		PerMessageTimeout: time.Duration(util.QueryParamInt(params, "perMessageTimeoutMs", 300)) * time.Millisecond,
+	}
+	if opts.Size < 1 || opts.Size > maxReadBatchSize {
+		return opts, fmt.Errorf("batchSize must be between 1 and %d", maxReadBatchSize)
+	}
+	if opts.PerMessageTimeout <= 0 {
+		return opts, errors.New("perMessageTimeoutMs must be a positive number")
+	}
+
+	cursor, startID, startTime := params.Get("cursor"), params.Get("startMessageId"), params.Get("startTime")
+	starts := 0
+	for _, str := range []string{cursor, startID, startTime} {
+		if str != "" {
+			starts++
+		}
+	}
+	if starts > 1 {
+		return opts, errors.New("only one of cursor, startMessageId, and startTime can be specified")
+	}
+
+	var err error
+	switch {
+	case cursor != "":
+		opts.StartID, err = model.ParseMessageID(cursor)
+	case startID != "":
+		opts.StartID, err = model.ParseMessageID(startID)
+		opts.Inclusive = true
+	case startTime != "":
+		var t time.Time
+		if t, err = parseTime(startTime); err == nil {
+			opts.StartTime = &t
+		}
+	}
+	return opts, err
+}
@@ -19,16 +19,16 @@ func NewRouter(mode *string) *mux.Router {
 
 		handler = route.HandlerFunc
 		handler = Logger(handler, route.Name)
+		// rate limit is applied after authentication so that it is keyed by the tenant
+		handler = middleware.LimitRate(route.Name)(handler)
 
 		router.
 			Methods(route.Method).
 			Path(route.Pattern).
 			Name(route.Name).
-			Handler(route.AuthFunc(handler))
+			Handler(middleware.LimitAuthFailures(route.Name)(route.AuthFunc(handler)))
 
 	}
-	// TODO rate limit can be added per route basis
-	router.Use(middleware.LimitRate)
 
 	log.Infof("router added")
 	return router
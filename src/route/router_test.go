@@ -10,10 +10,11 @@ func TestEffectiveRoutes(t *testing.T) {
 	receiverRoutesLen := len(ReceiverRoutes)
 	restRoutesLen := len(RestRoutes)
 	prometheusLen := len(PrometheusRoute)
+	pprofLen := len(PprofRoute)
 	// mode := "hybrid"
 	// assert.Equal(t, len(GetEffectiveRoutes(&mode)), (receiverRoutesLen + restRoutesLen + prometheusLen))
 	mode := "rest"
-	assert.Equal(t, len(GetEffectiveRoutes(&mode)), (receiverRoutesLen + restRoutesLen + prometheusLen))
+	assert.Equal(t, len(GetEffectiveRoutes(&mode)), (restRoutesLen + prometheusLen + pprofLen))
 	mode = "receiver"
-	assert.Equal(t, len(GetEffectiveRoutes(&mode)), (receiverRoutesLen + restRoutesLen + prometheusLen))
+	assert.Equal(t, len(GetEffectiveRoutes(&mode)), (receiverRoutesLen + prometheusLen + pprofLen))
 }
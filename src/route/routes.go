@@ -104,6 +104,20 @@ var ReceiverRoutes = Routes{
 		ReceiveHandler,
 		middleware.AuthVerifyJWT,
 	},
+	Route{
+		"Receive batch",
+		"POST",
+		"/v2/firehose/batch/{persistent}/{tenant}/{namespace}/{topic}",
+		ReceiveBatchHandler,
+		middleware.AuthVerifyJWT,
+	},
+	Route{
+		"Async send status",
+		http.MethodGet,
+		"/v2/firehose/status/{pulsarBeamId}",
+		AsyncSendStatusHandler,
+		middleware.AuthVerifyJWT,
+	},
 	Route{
 		"http-sse",
 		"GET",
@@ -111,6 +125,13 @@ var ReceiverRoutes = Routes{
 		SSEHandler,
 		middleware.AuthVerifyJWT,
 	},
+	Route{
+		"websocket",
+		http.MethodGet,
+		"/v2/ws/{persistent}/{tenant}/{namespace}/{topic}",
+		WebSocketHandler,
+		middleware.AuthVerifyJWT,
+	},
 	Route{
 		"poll-messages",
 		http.MethodGet,
@@ -118,6 +139,34 @@ var ReceiverRoutes = Routes{
 		PollHandler,
 		middleware.AuthVerifyJWT,
 	},
+	Route{
+		"read-messages",
+		http.MethodGet,
+		"/v2/read/{persistent}/{tenant}/{namespace}/{topic}",
+		ReadHandler,
+		middleware.AuthVerifyJWT,
+	},
+	Route{
+		"ack-messages",
+		http.MethodPost,
+		"/v2/ack/{persistent}/{tenant}/{namespace}/{topic}",
+		AckHandler,
+		middleware.AuthVerifyJWT,
+	},
+	Route{
+		"nack-messages",
+		http.MethodPost,
+		"/v2/nack/{persistent}/{tenant}/{namespace}/{topic}",
+		NackHandler,
+		middleware.AuthVerifyJWT,
+	},
+	Route{
+		"seek-subscription",
+		http.MethodPost,
+		"/v2/seek/{persistent}/{tenant}/{namespace}/{topic}",
+		SeekSubscriptionHandler,
+		middleware.AuthVerifyJWT,
+	},
 }
 
 // RestRoutes definition
@@ -136,6 +185,20 @@ var RestRoutes = Routes{
 		GetTopicHandler,
 		middleware.AuthVerifyJWT,
 	},
+	Route{
+		"Get webhook delivery status of a topic",
+		"GET",
+		"/v2/topic/{topicKey}/webhooks/status",
+		GetWebhookStatusHandler,
+		middleware.AuthVerifyJWT,
+	},
+	Route{
+		"Seek a webhook subscription of a topic",
+		"POST",
+		"/v2/topic/{topicKey}/webhooks/seek",
+		SeekWebhookHandler,
+		middleware.AuthVerifyJWT,
+	},
 	Route{
 		"Update a topic",
 		"POST",
@@ -0,0 +1,48 @@
+package route
+
+import (
+	"time"
+
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/kafkaesque-io/pulsar-beam/src/util"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// topicSchemaTTL is how long the schema of a topic is cached before it is read from the database again
+var topicSchemaTTL = time.Duration(util.GetEnvInt("TopicSchemaCacheTTL", 60)) * time.Second
+
+// topicSchemaCache caches the schema of topics, key is the topic key
+// A topic without schema is cached as a nil schema, so that the database is not queried on every message.
+var topicSchemaCache = util.NewCache(util.CacheOption{
+	TTL:            topicSchemaTTL,
+	CleanInterval:  topicSchemaTTL,
+	ExpireCallback: func(key string, value interface{}) {},
+})
+
+// getTopicSchema returns the schema of a topic, nil if the topic does not have a schema
+func getTopicSchema(topicFN, pulsarURL string) *model.TopicSchema {
+	key := model.GenKey(topicFN, pulsarURL)
+	if obj, ok := topicSchemaCache.Get(key); ok {
+		if schema, ok := obj.(*model.TopicSchema); ok {
+			return schema
+		}
+	}
+	if singleDb == nil {
+		return nil
+	}
+
+	var schema *model.TopicSchema
+	if doc, err := singleDb.GetByTopic(topicFN, pulsarURL); err == nil {
+		schema = doc.Schema
+	} else {
+		log.Debugf("no topic config for schema lookup topic %s error %v", topicFN, err)
+	}
+	topicSchemaCache.Set(key, schema)
+	return schema
+}
+
+// evictTopicSchema removes a topic's schema from the cache once the topic is updated or deleted
+func evictTopicSchema(topicFN, pulsarURL string) {
+	topicSchemaCache.Delete(model.GenKey(topicFN, pulsarURL))
+}
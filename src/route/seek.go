@@ -0,0 +1,105 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/kafkaesque-io/pulsar-beam/src/broker"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/kafkaesque-io/pulsar-beam/src/util"
+	log "github.com/sirupsen/logrus"
+)
+
+// SeekWebhookHandler resets the subscription of a webhook of a topic
+func SeekWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	topicKey, err := GetTopicKey(r)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
+	req, err := decodeSeekRequest(r)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
+	if req.Subscription == "" {
+		util.ResponseErrorJSON(errors.New("missing webhook subscription"), w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	doc, err := singleDb.GetByKey(topicKey)
+	if err != nil {
+		log.Errorf("get topic error %v", err)
+		util.ResponseErrorJSON(err, w, http.StatusNotFound)
+		return
+	}
+	if !VerifySubjectBasedOnTopic(doc.TopicFullName, r.Header.Get("injectedSubs"), ExtractEvalTenant) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	for _, wh := range doc.Webhooks {
+		if wh.Subscription != req.Subscription {
+			continue
+		}
+		if err = broker.SeekWebhook(doc, wh, req); err != nil {
+			util.ResponseErrorJSON(fmt.Errorf("failed to seek subscription %s error %v", req.Subscription, err), w, seekErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	util.ResponseErrorJSON(fmt.Errorf("webhook subscription %s not found", req.Subscription), w, http.StatusNotFound)
+}
+
+// SeekSubscriptionHandler resets a durable subscription consumed by the poll endpoint
+func SeekSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	defer recoverHandler(r)
+
+	token, topicFN, pulsarURL, subName, _, subType, err := ConsumerConfigFromHTTPParts(util.AllowedPulsarURLs, &r.Header, mux.Vars(r), r.URL.Query())
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
+	if strings.HasPrefix(subName, model.NonResumable) {
+		util.ResponseErrorJSON(errors.New("SubscriptionName is required"), w, http.StatusUnprocessableEntity)
+		return
+	}
+	req, err := decodeSeekRequest(r)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
+	if !VerifySubjectBasedOnTopic(topicFN, r.Header.Get("injectedSubs"), ExtractEvalTenant) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if err = broker.SeekPollSubscription(pulsarURL, token, topicFN, subName, subType, req); err != nil {
+		util.ResponseErrorJSON(fmt.Errorf("failed to seek subscription %s error %v", subName, err), w, seekErrorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// seekErrorStatus returns 409 if the subscription is held by a consumer in another process
+func seekErrorStatus(err error) int {
+	if errors.Is(err, broker.ErrSubscriptionBusy) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// decodeSeekRequest decodes and validates the seek request body
+func decodeSeekRequest(r *http.Request) (model.SeekRequest, error) {
+	var req model.SeekRequest
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, err
+	}
+	return req, model.ValidateSeekRequest(req)
+}
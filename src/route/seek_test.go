@@ -0,0 +1,17 @@
+package route
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/kafkaesque-io/pulsar-beam/src/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeekErrorStatus(t *testing.T) {
+	busy := fmt.Errorf("%w: webhook-sub", broker.ErrSubscriptionBusy)
+	assert.Equal(t, http.StatusConflict, seekErrorStatus(busy))
+	assert.Equal(t, http.StatusInternalServerError, seekErrorStatus(errors.New("failed to subscribe")))
+}
@@ -0,0 +1,134 @@
+package route
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/kafkaesque-io/pulsar-beam/src/util"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sseOptions are the formatting options of SSE events
+type sseOptions struct {
+	// envelope sends the data as a JSON envelope of model.PulsarMessage instead of the raw payload
+	envelope bool
+	// utf8 sends the payload in the envelope as a UTF-8 string instead of base64
+	utf8 bool
+	// eventKey sets the event name to the message key
+	eventKey bool
+	// eventProperty sets the event name to the value of the message property
+	eventProperty string
+}
+
+// parseSSEOptions parses the query parameters format, payloadEncoding, and event
+func parseSSEOptions(params url.Values) (sseOptions, error) {
+	opts := sseOptions{}
+	switch format := params.Get("format"); format {
+	case "", "raw":
+	case "envelope":
+		opts.envelope = true
+	default:
+		return opts, fmt.Errorf("unsupported format %s, supported formats are raw and envelope", format)
+	}
+
+	switch encoding := params.Get("payloadEncoding"); encoding {
+	case "", "base64":
+	case "utf8":
+		opts.utf8 = true
+	default:
+		return opts, fmt.Errorf("unsupported payloadEncoding %s, supported encodings are base64 and utf8", encoding)
+	}
+
+	event := params.Get("event")
+	switch {
+	case event == "":
+	case event == "key":
+		opts.eventKey = true
+	case strings.HasPrefix(event, "property:") && len(event) > len("property:"):
+		opts.eventProperty = strings.TrimPrefix(event, "property:")
+	default:
+		return opts, fmt.Errorf("unsupported event %s, the format is key or property:<name>", event)
+	}
+	return opts, nil
+}
+
+// eventName returns the event name of a message, an empty name is the default message event
+func (o sseOptions) eventName(msg pulsar.Message) string {
+	name := ""
+	if o.eventKey {
+		name = msg.Key()
+	} else if o.eventProperty != "" {
+		name = msg.Properties()[o.eventProperty]
+	}
+	// a line break would end the field
+	return strings.NewReplacer("\r", "", "\n", "").Replace(name)
+}
+
+// writeEvent writes a message as an event with the base64 encoded message id as the event id
+func (o sseOptions) writeEvent(w io.Writer, msg pulsar.Message, payload []byte) error {
+	data := payload
+	if o.envelope {
+		var err error
+		envelope := model.NewPulsarMessage(msg, payload)
+		if o.utf8 {
+			data, err = json.Marshal(model.PulsarTextMessage{PulsarMessage: envelope, Payload: string(payload)})
+		} else {
+			data, err = json.Marshal(envelope)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("id: " + model.MessageIDString(msg.ID()) + "\n")
+	if name := o.eventName(msg); name != "" {
+		buf.WriteString("event: " + name + "\n")
+	}
+	writeSSEData(&buf, data)
+	buf.WriteString("\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeSSEData writes every line of the data in a data field, since a line break ends a field
+// A client joins the data fields of an event with a line feed.
+func writeSSEData(buf *bytes.Buffer, data []byte) {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteString("\n")
+	}
+}
+
+// sentBefore checks if a message received after seeking the last event id has been sent before the reconnect
+// A seek resets the subscription to the entry of the message id, so the last event, and the events before it
+// in the same batch, are redelivered.
+func sentBefore(id, lastEventID pulsar.MessageID) bool {
+	return id.LedgerID() == lastEventID.LedgerID() && id.EntryID() == lastEventID.EntryID() && id.BatchIdx() <= lastEventID.BatchIdx()
+}
+
+// sseTimings returns the keep-alive interval and the reconnection time of SSE streams
+func sseTimings(config *util.Configuration) (time.Duration, time.Duration) {
+	keepAlive, err := time.ParseDuration(util.AssignString(config.SSEKeepAliveInterval, "15s"))
+	if err != nil {
+		log.Errorf("invalid SSEKeepAliveInterval %s error %v", config.SSEKeepAliveInterval, err)
+		keepAlive = 15 * time.Second
+	}
+	retry, err := time.ParseDuration(util.AssignString(config.SSERetry, "3s"))
+	if err != nil {
+		log.Errorf("invalid SSERetry %s error %v", config.SSERetry, err)
+		retry = 3 * time.Second
+	}
+	return keepAlive, retry
+}
@@ -0,0 +1,86 @@
+package route
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// testMessage implements the pulsar.Message methods used by SSE formatting
+type testMessage struct {
+	pulsar.Message
+	key        string
+	properties map[string]string
+}
+
+func (m testMessage) Topic() string                 { return "persistent://tenant/ns/topic" }
+func (m testMessage) ID() pulsar.MessageID          { return pulsar.EarliestMessageID() }
+func (m testMessage) Key() string                   { return m.key }
+func (m testMessage) Properties() map[string]string { return m.properties }
+func (m testMessage) EventTime() time.Time          { return time.Time{} }
+func (m testMessage) PublishTime() time.Time        { return time.Unix(1590000000, 0).UTC() }
+
+func TestParseSSEOptions(t *testing.T) {
+	opts, err := parseSSEOptions(url.Values{})
+	assert.Nil(t, err)
+	assert.Equal(t, sseOptions{}, opts)
+
+	opts, err = parseSSEOptions(url.Values{"format": {"envelope"}, "payloadEncoding": {"utf8"}, "event": {"property:type"}})
+	assert.Nil(t, err)
+	assert.Equal(t, sseOptions{envelope: true, utf8: true, eventProperty: "type"}, opts)
+
+	_, err = parseSSEOptions(url.Values{"format": {"xml"}})
+	assert.EqualError(t, err, "unsupported format xml, supported formats are raw and envelope")
+	_, err = parseSSEOptions(url.Values{"payloadEncoding": {"hex"}})
+	assert.EqualError(t, err, "unsupported payloadEncoding hex, supported encodings are base64 and utf8")
+	_, err = parseSSEOptions(url.Values{"event": {"property:"}})
+	assert.EqualError(t, err, "unsupported event property:, the format is key or property:<name>")
+}
+
+func TestWriteSSEEvent(t *testing.T) {
+	id := model.MessageIDString(pulsar.EarliestMessageID())
+	msg := testMessage{key: "order\n1", properties: map[string]string{"type": "created"}}
+
+	var buf bytes.Buffer
+	assert.Nil(t, sseOptions{eventKey: true}.writeEvent(&buf, msg, []byte("line1\r\nline2\nline3")))
+	assert.Equal(t, "id: "+id+"\nevent: order1\ndata: line1\ndata: line2\ndata: line3\n\n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, sseOptions{envelope: true, utf8: true, eventProperty: "type"}.writeEvent(&buf, msg, []byte("hello")))
+	assert.Equal(t, "id: "+id+"\nevent: created\ndata: {\"topic\":\"persistent://tenant/ns/topic\",\"eventTime\":\"0001-01-01T00:00:00Z\","+
+		"\"publishTime\":\"2020-05-20T18:40:00Z\",\"messageId\":\""+fmt.Sprintf("%+v", pulsar.EarliestMessageID())+"\",\"messageIdEncoded\":\""+id+"\",\"key\":\"order\\n1\",\"properties\":{\"type\":\"created\"},\"payload\":\"hello\"}\n\n", buf.String())
+
+	buf.Reset()
+	assert.Nil(t, sseOptions{envelope: true}.writeEvent(&buf, msg, []byte("hello")))
+	assert.Contains(t, buf.String(), "\"payload\":\"aGVsbG8=\"")
+}
+
+// testMessageID implements the pulsar.MessageID position methods
+type testMessageID struct {
+	pulsar.MessageID
+	ledger, entry int64
+	batch         int32
+}
+
+func (id testMessageID) LedgerID() int64 { return id.ledger }
+func (id testMessageID) EntryID() int64  { return id.entry }
+func (id testMessageID) BatchIdx() int32 { return id.batch }
+
+func TestSentBefore(t *testing.T) {
+	last := testMessageID{ledger: 5, entry: 10, batch: -1}
+	assert.True(t, sentBefore(testMessageID{ledger: 5, entry: 10, batch: -1}, last))
+	assert.False(t, sentBefore(testMessageID{ledger: 5, entry: 11, batch: -1}, last))
+	assert.False(t, sentBefore(testMessageID{ledger: 6, entry: 0, batch: -1}, last))
+
+	// the messages of a batch up to the last event are redelivered by the seek
+	last = testMessageID{ledger: 5, entry: 10, batch: 2}
+	assert.True(t, sentBefore(testMessageID{ledger: 5, entry: 10, batch: 0}, last))
+	assert.True(t, sentBefore(testMessageID{ledger: 5, entry: 10, batch: 2}, last))
+	assert.False(t, sentBefore(testMessageID{ledger: 5, entry: 10, batch: 3}, last))
+}
@@ -0,0 +1,290 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/gorilla/mux"
+	"github.com/kafkaesque-io/pulsar-beam/src/broker"
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/kafkaesque-io/pulsar-beam/src/pulsardriver"
+	"github.com/kafkaesque-io/pulsar-beam/src/util"
+	"golang.org/x/net/websocket"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WebSocket endpoint
+// A WebSocket connection streams messages of a topic subscription as JSON frames. Unlike SSE, a message is
+// not acknowledged until the client sends an ack frame with its message id, and a nack frame redelivers it.
+// Messages are only delivered while the client has permits, which are granted by the permits query parameter
+// on connect and flow frames afterwards. The client can also publish messages to the topic on the same connection.
+
+const (
+	defaultWebSocketPermits = 100
+
+	// the max number of permits and unacknowledged messages of a connection
+	maxWebSocketPermits = 10000
+
+	// the max number of publishes waiting for the Pulsar receipt on a connection
+	maxWebSocketPublishes = 100
+
+	// a frame up to the default Pulsar max message size plus the JSON and base64 overhead
+	maxWebSocketFrameBytes = 8 << 20
+)
+
+// WebSocketHandler is the WebSocket handler to stream, acknowledge, and publish messages
+func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	defer recoverHandler(r)
+
+	params := r.URL.Query()
+	token, topicFN, pulsarURL, subName, subInitPos, subType, err := ConsumerConfigFromHTTPParts(util.AllowedPulsarURLs, &r.Header, mux.Vars(r), params)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusUnprocessableEntity)
+		return
+	}
+	permits := util.QueryParamInt(params, "permits", defaultWebSocketPermits)
+	if permits < 0 || permits > maxWebSocketPermits {
+		util.ResponseErrorJSON(fmt.Errorf("permits must be between 0 and %d", maxWebSocketPermits), w, http.StatusUnprocessableEntity)
+		return
+	}
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		util.ResponseErrorJSON(errors.New("WebSocket upgrade is required"), w, http.StatusBadRequest)
+		return
+	}
+	if err = checkWebSocketOrigin(r.Header.Get("Origin")); err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusForbidden)
+		return
+	}
+
+	client, consumer, err := broker.GetPulsarClientConsumer(pulsarURL, token, topicFN, subName, subType, subInitPos)
+	if err != nil {
+		util.ResponseErrorJSON(err, w, http.StatusInternalServerError)
+		return
+	}
+	defer client.Close()
+	defer consumer.Close()
+	if strings.HasPrefix(subName, model.NonResumable) {
+		defer consumer.Unsubscribe()
+	}
+
+	session := &webSocketSession{
+		consumer:  consumer,
+		pulsarURL: pulsarURL,
+		token:     token,
+		topicFN:   topicFN,
+		schema:    getTopicSchema(topicFN, pulsarURL),
+		permits:   permits,
+		unacked:   make(map[string]pulsar.Message),
+		publishes: make(chan struct{}, maxWebSocketPublishes),
+	}
+	websocket.Server{
+		Handshake: func(_ *websocket.Config, r *http.Request) error { return checkWebSocketOrigin(r.Header.Get("Origin")) },
+		Handler:   session.serve,
+	}.ServeHTTP(w, r)
+}
+
+// checkWebSocketOrigin verifies the Origin of a connection against the WebSocketAllowedOrigins config,
+// so that a page of another site cannot open a connection with the credentials of the browser.
+// A connection without the Origin header is allowed since it is not opened by a browser.
+func checkWebSocketOrigin(origin string) error {
+	if origin == "" {
+		return nil
+	}
+	for _, allowed := range strings.Split(util.GetConfig().WebSocketAllowedOrigins, ",") {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "*" || (allowed != "" && strings.EqualFold(allowed, origin)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %s is not allowed", origin)
+}
+
+// webSocketSession is the state of a WebSocket connection
+type webSocketSession struct {
+	ws        *websocket.Conn
+	consumer  pulsar.Consumer
+	pulsarURL string
+	token     string
+	topicFN   string
+	schema    *model.TopicSchema
+	permits   int
+	unacked   map[string]pulsar.Message
+	publishes chan struct{}
+	inflight  sync.WaitGroup
+	writeLock sync.Mutex
+}
+
+// serve delivers messages and handles client frames until the connection is closed
+func (s *webSocketSession) serve(ws *websocket.Conn) {
+	s.ws = ws
+	ws.MaxPayloadBytes = maxWebSocketFrameBytes
+	defer s.inflight.Wait()
+	defer ws.Close()
+
+	requests := make(chan model.WebSocketRequest)
+	closed := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go s.read(requests, closed, done)
+
+	ctx := ws.Request().Context()
+	for {
+		// stop receiving messages from the consumer until the client grants more permits
+		var msgs <-chan pulsar.ConsumerMessage
+		if s.permits > 0 && len(s.unacked) < maxWebSocketPermits {
+			msgs = s.consumer.Chan()
+		}
+
+		select {
+		case cm := <-msgs:
+			s.deliver(cm.Message)
+		case req := <-requests:
+			s.handle(req)
+		case <-closed:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// read receives client frames until the connection is closed or the session is done
+func (s *webSocketSession) read(requests chan<- model.WebSocketRequest, closed, done chan struct{}) {
+	defer close(closed)
+	for {
+		var req model.WebSocketRequest
+		err := websocket.JSON.Receive(s.ws, &req)
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.Is(err, websocket.ErrFrameTooLarge) || errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+			s.sendError("", fmt.Errorf("invalid frame %v", err))
+			continue
+		} else if err != nil {
+			return
+		}
+		if req.Type == model.WebSocketPublish {
+			// stops reading the next frame once the max number of publishes are in flight,
+			// without holding up the deliveries and acks of the serve loop
+			select {
+			case s.publishes <- struct{}{}:
+			case <-done:
+				return
+			}
+		}
+		select {
+		case requests <- req:
+		case <-done:
+			if req.Type == model.WebSocketPublish {
+				<-s.publishes
+			}
+			return
+		}
+	}
+}
+
+// deliver sends a message to the client and keeps it until it is acknowledged
+func (s *webSocketSession) deliver(msg pulsar.Message) {
+	frame := model.NewWebSocketMessage(msg, broker.DecodePayload(s.schema, msg))
+	s.permits--
+	s.unacked[frame.MessageID] = msg
+	s.send(frame)
+}
+
+// handle processes a client frame
+func (s *webSocketSession) handle(req model.WebSocketRequest) {
+	switch req.Type {
+	case model.WebSocketAck, model.WebSocketNack:
+		msg, ok := s.unacked[req.MessageID]
+		if !ok {
+			s.sendError(req.Context, fmt.Errorf("unknown message id %s", req.MessageID))
+			return
+		}
+		delete(s.unacked, req.MessageID)
+		if req.Type == model.WebSocketAck {
+			s.consumer.Ack(msg)
+		} else {
+			s.consumer.Nack(msg)
+		}
+	case model.WebSocketFlow:
+		if req.Permits <= 0 {
+			s.sendError(req.Context, errors.New("permits must be a positive number"))
+			return
+		}
+		s.permits += req.Permits
+		if s.permits > maxWebSocketPermits {
+			s.permits = maxWebSocketPermits
+		}
+	case model.WebSocketPublish:
+		// the publish slot has been acquired by the reader
+		s.inflight.Add(1)
+		go func() {
+			defer func() {
+				<-s.publishes
+				s.inflight.Done()
+			}()
+			s.publish(req)
+		}()
+	default:
+		s.sendError(req.Context, fmt.Errorf("unsupported frame type %s", req.Type))
+	}
+}
+
+// publish sends a message to the topic and replies with the message id
+func (s *webSocketSession) publish(req model.WebSocketRequest) {
+	if len(req.Payload) > 0 && len(req.PayloadBase64) > 0 {
+		s.sendError(req.Context, errors.New("a message cannot have both payload and payloadBase64"))
+		return
+	}
+	payload, err := s.schema.Encode(req.Data())
+	if err != nil {
+		s.sendError(req.Context, err)
+		return
+	}
+	if len(payload) == 0 {
+		s.sendError(req.Context, errors.New("a message has no payload"))
+		return
+	}
+	message := &pulsar.ProducerMessage{
+		Payload:    payload,
+		Key:        req.Key,
+		Properties: req.Properties,
+	}
+	if req.EventTime != nil {
+		message.EventTime = *req.EventTime
+	}
+
+	id, err := pulsardriver.SendMessageToPulsar(s.pulsarURL, s.token, s.topicFN, s.schema.PulsarSchema(), message, false)
+	if err != nil {
+		s.sendError(req.Context, err)
+		return
+	}
+	s.send(model.WebSocketMessage{
+		Type:         model.WebSocketPublished,
+		MessageID:    model.MessageIDString(id),
+		Context:      req.Context,
+		PulsarBeamID: message.Properties["PulsarBeamId"],
+	})
+}
+
+func (s *webSocketSession) sendError(context string, err error) {
+	s.send(model.WebSocketMessage{
+		Type:    model.WebSocketError,
+		Context: context,
+		Error:   err.Error(),
+	})
+}
+
+// send writes a frame, it is called by the delivery loop and publishes concurrently
+func (s *webSocketSession) send(frame model.WebSocketMessage) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	if err := websocket.JSON.Send(s.ws, frame); err != nil {
+		log.Warnf("failed to send WebSocket frame on topic %s error %v", s.topicFN, err)
+	}
+}
@@ -0,0 +1,67 @@
+package route
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kafkaesque-io/pulsar-beam/src/model"
+	"github.com/kafkaesque-io/pulsar-beam/src/util"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func TestCheckWebSocketOrigin(t *testing.T) {
+	defer func(origins string) { util.GetConfig().WebSocketAllowedOrigins = origins }(util.GetConfig().WebSocketAllowedOrigins)
+
+	util.GetConfig().WebSocketAllowedOrigins = ""
+	assert.Nil(t, checkWebSocketOrigin(""))
+	assert.EqualError(t, checkWebSocketOrigin("https://app.example.com"), "origin https://app.example.com is not allowed")
+
+	util.GetConfig().WebSocketAllowedOrigins = "https://app.example.com, https://admin.example.com"
+	assert.Nil(t, checkWebSocketOrigin("https://admin.example.com"))
+	assert.Nil(t, checkWebSocketOrigin("HTTPS://APP.example.com"))
+	assert.NotNil(t, checkWebSocketOrigin("https://evil.example.com"))
+
+	util.GetConfig().WebSocketAllowedOrigins = "*"
+	assert.Nil(t, checkWebSocketOrigin("https://evil.example.com"))
+}
+
+// TestWebSocketReadPublishSlot verifies the reader holds a publish frame until a publish slot is free,
+// while the frames read before it are forwarded to the serve loop.
+func TestWebSocketReadPublishSlot(t *testing.T) {
+	s := &webSocketSession{publishes: make(chan struct{}, 1)}
+	requests := make(chan model.WebSocketRequest)
+	closed, done := make(chan struct{}), make(chan struct{})
+	defer close(done)
+
+	server := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		s.ws = ws
+		s.read(requests, closed, done)
+	}))
+	defer server.Close()
+	client, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+	assert.Nil(t, err)
+	defer client.Close()
+
+	for _, frame := range []string{`{"type":"publish","context":"p1"}`, `{"type":"publish","context":"p2"}`, `{"type":"ack","messageId":"m1"}`} {
+		assert.Nil(t, websocket.Message.Send(client, frame))
+	}
+
+	req := <-requests
+	assert.Equal(t, "p1", req.Context)
+	assert.Equal(t, 1, len(s.publishes))
+	select {
+	case req = <-requests:
+		t.Fatalf("unexpected frame %v forwarded while the publish slots are taken", req)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// a publish of p1 completes
+	<-s.publishes
+	req = <-requests
+	assert.Equal(t, "p2", req.Context)
+	req = <-requests
+	assert.Equal(t, model.WebSocketAck, req.Type)
+}
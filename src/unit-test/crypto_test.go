@@ -2,6 +2,8 @@ package tests
 
 import (
 	"fmt"
+	"net/http"
+	"strconv"
 	"testing"
 	"time"
 
@@ -169,3 +171,30 @@ func TestJWTRSASignAndVerifyWithPKCS12Keys(t *testing.T) {
 	equals(t, expireOffset, 3600)
 
 }
+
+func TestWebhookSignature(t *testing.T) {
+	secret := []byte("webhook-signing-secret")
+	body := []byte(`{"hello":"world"}`)
+	ts := time.Now().Unix()
+	sig := SignWebhook(secret, ts, "msgid-1", body)
+	assert(t, len(sig) == 67, "v1= prefix and 64 hex characters")
+
+	errNil(t, VerifyWebhookSignature(secret, strconv.FormatInt(ts, 10), "msgid-1", sig, body, DefaultSignatureTolerance))
+	assertErr(t, "webhook signature mismatch", VerifyWebhookSignature(secret, strconv.FormatInt(ts, 10), "msgid-2", sig, body, DefaultSignatureTolerance))
+	assertErr(t, "webhook signature mismatch", VerifyWebhookSignature([]byte("another-secret"), strconv.FormatInt(ts, 10), "msgid-1", sig, body, DefaultSignatureTolerance))
+	assertErr(t, "invalid webhook signature timestamp", VerifyWebhookSignature(secret, "now", "msgid-1", sig, body, DefaultSignatureTolerance))
+
+	oldTs := time.Now().Add(-10 * time.Minute).Unix()
+	oldSig := SignWebhook(secret, oldTs, "msgid-1", body)
+	assertErr(t, "webhook signature timestamp is out of tolerance", VerifyWebhookSignature(secret, strconv.FormatInt(oldTs, 10), "msgid-1", oldSig, body, DefaultSignatureTolerance))
+	// zero tolerance skips the timestamp check
+	errNil(t, VerifyWebhookSignature(secret, strconv.FormatInt(oldTs, 10), "msgid-1", oldSig, body, 0))
+
+	h := http.Header{}
+	assertErr(t, "missing webhook signature", VerifyWebhookRequest(secret, h, body, DefaultSignatureTolerance))
+	h.Set(WebhookTimestampHeader, strconv.FormatInt(ts, 10))
+	h.Set(WebhookSignatureHeader, sig)
+	h.Set(WebhookMessageIDHeader, "msgid-1")
+	errNil(t, VerifyWebhookRequest(secret, h, body, DefaultSignatureTolerance))
+	assertErr(t, "webhook signature mismatch", VerifyWebhookRequest(secret, h, []byte(`{"hello":"beam"}`), DefaultSignatureTolerance))
+}
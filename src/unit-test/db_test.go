@@ -216,3 +216,55 @@ func TestPulsarDbDriver(t *testing.T) {
 	// Comment out because there are other test cases require database.
 	errNil(t, pulsardb.Close())
 }
+
+func TestInMemoryWebhookStats(t *testing.T) {
+	inmemorydb, err := NewInMemoryHandler()
+	errNil(t, err)
+
+	_, err = inmemorydb.GetWebhookStats("nokey")
+	equals(t, DocNotFound, err.Error())
+
+	stats := model.WebhookDeliveryStats{Delivered: 3, Failed: 1, LastStatusCode: 500}
+	errNil(t, inmemorydb.SaveWebhookStats("subkey", stats))
+	stored, err := inmemorydb.GetWebhookStats("subkey")
+	errNil(t, err)
+	equals(t, stats, *stored)
+
+	stats.Delivered = 4
+	errNil(t, inmemorydb.SaveWebhookStats("subkey", stats))
+	stored, err = inmemorydb.GetWebhookStats("subkey")
+	errNil(t, err)
+	equals(t, uint64(4), stored.Delivered)
+}
+
+func TestInMemoryUpdateWebhookStatus(t *testing.T) {
+	inmemorydb, err := NewInMemoryHandler()
+	errNil(t, err)
+
+	topic, err := model.NewTopicConfig("persistent://mytenant/local-useast1-gcp/status-topic", "pulsar+ssl://useast1.gcp.kafkaesque.io:6651", "token")
+	errNil(t, err)
+	wh := model.NewWebhookConfig("http://localhost:8089")
+	topic.Webhooks = []model.WebhookConfig{wh}
+	key, err := inmemorydb.Create(&topic)
+	errNil(t, err)
+
+	// a topic update in the meantime is kept by the status update
+	topic.Notes = "updated notes"
+	_, err = inmemorydb.Update(&topic)
+	errNil(t, err)
+
+	errNil(t, inmemorydb.UpdateWebhookStatus(key, wh.URL, model.Activated, model.Suspended, "suspended"))
+	doc, err := inmemorydb.GetByKey(key)
+	errNil(t, err)
+	equals(t, "updated notes", doc.Notes)
+	equals(t, model.Suspended, doc.Webhooks[0].WebhookStatus)
+	equals(t, "suspended", doc.Webhooks[0].StatusReason)
+
+	// the status is only set if the webhook is in the expected status
+	err = inmemorydb.UpdateWebhookStatus(key, wh.URL, model.Activated, model.Suspended, "suspended again")
+	assert(t, err != nil, "expect an error on an unexpected status")
+	err = inmemorydb.UpdateWebhookStatus(key, "http://localhost:9999", model.Suspended, model.Activated, "")
+	assert(t, err != nil, "expect an error on a non-existent webhook")
+	err = inmemorydb.UpdateWebhookStatus("nokey", wh.URL, model.Suspended, model.Activated, "")
+	equals(t, DocNotFound, err.Error())
+}
@@ -5,12 +5,17 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/apache/pulsar-client-go/pulsar"
 	"github.com/gorilla/mux"
+	"github.com/kafkaesque-io/pulsar-beam/src/broker"
+	"github.com/kafkaesque-io/pulsar-beam/src/db"
+	"github.com/kafkaesque-io/pulsar-beam/src/icrypto"
 	"github.com/kafkaesque-io/pulsar-beam/src/model"
 	. "github.com/kafkaesque-io/pulsar-beam/src/route"
 	"github.com/kafkaesque-io/pulsar-beam/src/util"
@@ -143,6 +148,26 @@ func TestTopicHandler(t *testing.T) {
 	handler.ServeHTTP(rr, req)
 	equals(t, http.StatusOK, rr.Code)
 
+	// test to get the webhook delivery status of a topic
+	req, err = http.NewRequest(http.MethodGet, "/v2/topic/"+key+"/webhooks/status", nil)
+	errNil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"topicKey": key})
+
+	req.Header.Set("injectedSubs", "picasso")
+	rr = httptest.NewRecorder()
+	handler = http.HandlerFunc(GetWebhookStatusHandler)
+
+	handler.ServeHTTP(rr, req)
+	equals(t, http.StatusOK, rr.Code)
+	var states []model.WebhookState
+	errNil(t, json.Unmarshal(rr.Body.Bytes(), &states))
+	equals(t, 0, len(states))
+
+	req.Header.Set("injectedSubs", "another-tenant")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	equals(t, http.StatusForbidden, rr.Code)
+
 	// test to delete a topic
 	req, err = http.NewRequest(http.MethodDelete, "/v2/topic/"+key, bytes.NewReader(reqKeyJSON))
 	errNil(t, err)
@@ -185,6 +210,46 @@ func TestTopicHandler(t *testing.T) {
 
 }
 
+// TestWebhookStatusFromDatabase serves the delivery stats written to the database by a webhook broker
+// without a webhook broker running in this process, which is the case of the REST API in the rest mode.
+// The database is the only state shared by the REST and webhook broker processes.
+func TestWebhookStatusFromDatabase(t *testing.T) {
+	util.Init()
+	Init()
+	store := db.NewDbWithPanic(util.GetConfig().PbDbType)
+
+	topic, err := model.NewTopicConfig("persistent://picasso/local-useast1-gcp/stats-topic", "pulsar+ssl://useast1.gcp.kafkaesque.io:6651", "token")
+	errNil(t, err)
+	served := model.NewWebhookConfig("http://localhost:8089/served")
+	idle := model.NewWebhookConfig("http://localhost:8089/idle")
+	topic.Webhooks = []model.WebhookConfig{served, idle}
+	key, err := store.Create(&topic)
+	errNil(t, err)
+	defer store.DeleteByKey(key)
+
+	// the writer of a webhook broker in another process
+	errNil(t, store.SaveWebhookStats(broker.SubscriptionKey(key, served), model.WebhookDeliveryStats{Delivered: 5, Failed: 2, LastStatusCode: 200}))
+
+	req, err := http.NewRequest(http.MethodGet, "/v2/topic/"+key+"/webhooks/status", nil)
+	errNil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"topicKey": key})
+	req.Header.Set("injectedSubs", "picasso")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(GetWebhookStatusHandler).ServeHTTP(rr, req)
+	equals(t, http.StatusOK, rr.Code)
+
+	var states []model.WebhookState
+	errNil(t, json.Unmarshal(rr.Body.Bytes(), &states))
+	equals(t, 2, len(states))
+	equals(t, served.URL, states[0].URL)
+	assert(t, states[0].Stats != nil, "expect the stats saved in the database")
+	equals(t, uint64(5), states[0].Stats.Delivered)
+	equals(t, uint64(2), states[0].Stats.Failed)
+	equals(t, 200, states[0].Stats.LastStatusCode)
+	equals(t, idle.URL, states[1].URL)
+	assert(t, states[1].Stats == nil, "expect no stats for a webhook without delivery")
+}
+
 func TestFireHoseReceiverHandler(t *testing.T) {
 
 	req, err := http.NewRequest(http.MethodPost, "/v1/firehose", bytes.NewReader([]byte{}))
@@ -337,6 +402,238 @@ func TestTopicModelFunctions(t *testing.T) {
 	errNil(t, err)
 }
 
+// test webhook dead-letter policy
+func TestDeadLetterPolicy(t *testing.T) {
+	wh := model.NewWebhookConfig("http://localhost:9000/webhook")
+	equals(t, uint32(0), wh.DeadLetterPolicy.MaxDeliveries)
+	errNil(t, model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+	equals(t, "persistent://picasso/ns/topic-"+wh.Subscription+"-DLQ", model.GetDeadLetterTopic("persistent://picasso/ns/topic", wh))
+
+	wh.DeadLetterPolicy.DeadLetterTopic = "persistent://picasso/ns/deadletters"
+	err := model.ValidateWebhookConfig([]model.WebhookConfig{wh})
+	assert(t, strings.HasPrefix(err.Error(), "dead-letter topic"), "a dead-letter topic requires maxDeliveries")
+
+	wh.DeadLetterPolicy.MaxDeliveries = 3
+	errNil(t, model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+	equals(t, "persistent://picasso/ns/deadletters", model.GetDeadLetterTopic("persistent://picasso/ns/topic", wh))
+
+	wh.DeadLetterPolicy.DeadLetterTopic = "picasso/ns/deadletters"
+	err = model.ValidateWebhookConfig([]model.WebhookConfig{wh})
+	assertErr(t, "invalid dead-letter topic full name picasso/ns/deadletters", err)
+}
+
+// test webhook retry policy
+func TestRetryPolicy(t *testing.T) {
+	wh := model.NewWebhookConfig("http://localhost:9000/webhook")
+	equals(t, model.NewRetryPolicy(), model.GetRetryPolicy(wh))
+	minBackoff, maxBackoff, timeout, err := model.GetRetryPolicy(wh).Durations()
+	errNil(t, err)
+	equals(t, 2*time.Second, minBackoff)
+	equals(t, 28*time.Second, maxBackoff)
+	equals(t, time.Duration(0), timeout)
+
+	wh.RetryPolicy = &model.RetryPolicy{
+		MaxRetries:           3,
+		MinBackoff:           "500ms",
+		Timeout:              "5s",
+		RetryableStatusCodes: []int{429, 503},
+	}
+	errNil(t, model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+	minBackoff, maxBackoff, timeout, err = model.GetRetryPolicy(wh).Durations()
+	errNil(t, err)
+	equals(t, 500*time.Millisecond, minBackoff)
+	equals(t, 28*time.Second, maxBackoff)
+	equals(t, 5*time.Second, timeout)
+
+	wh.RetryPolicy.MaxRetries = 11
+	err = model.ValidateWebhookConfig([]model.WebhookConfig{wh})
+	assertErr(t, "retry policy maxRetries must be between 0 and 10", err)
+
+	wh.RetryPolicy.MaxRetries = 0
+	wh.RetryPolicy.MaxBackoff = "100ms"
+	err = model.ValidateWebhookConfig([]model.WebhookConfig{wh})
+	assert(t, err != nil, "minBackoff cannot be greater than maxBackoff")
+
+	wh.RetryPolicy.MaxBackoff = "ten seconds"
+	err = model.ValidateWebhookConfig([]model.WebhookConfig{wh})
+	assertErr(t, "invalid retry policy maxBackoff ten seconds", err)
+
+	wh.RetryPolicy.MaxBackoff = ""
+	wh.RetryPolicy.RetryableStatusCodes = []int{5000}
+	err = model.ValidateWebhookConfig([]model.WebhookConfig{wh})
+	assertErr(t, "invalid retryable status code 5000", err)
+}
+
+// test webhook batch policy
+func TestBatchPolicy(t *testing.T) {
+	policy := model.BatchPolicy{}
+	maxMessages, maxBytes, maxLinger, err := policy.Limits()
+	errNil(t, err)
+	equals(t, 100, maxMessages)
+	equals(t, 1024*1024, maxBytes)
+	equals(t, time.Second, maxLinger)
+
+	wh := model.NewWebhookConfig("http://localhost:9000/webhook")
+	wh.Batch = &model.BatchPolicy{MaxMessages: 50, MaxLinger: "200ms"}
+	errNil(t, model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+
+	wh.Batch.MaxMessages = 10001
+	err = model.ValidateWebhookConfig([]model.WebhookConfig{wh})
+	assertErr(t, "batch maxMessages must be between 1 and 10000", err)
+
+	wh.Batch.MaxMessages = 0
+	wh.Batch.MaxLinger = "-1s"
+	err = model.ValidateWebhookConfig([]model.WebhookConfig{wh})
+	assertErr(t, "batch maxBytes and maxLinger must be positive", err)
+
+	wh.Batch.MaxLinger = "soon"
+	err = model.ValidateWebhookConfig([]model.WebhookConfig{wh})
+	assertErr(t, "invalid batch maxLinger soon", err)
+}
+
+// test webhook delivery concurrency
+func TestWebhookConcurrency(t *testing.T) {
+	wh := model.NewWebhookConfig("http://localhost:9000/webhook")
+	equals(t, 1, model.GetConcurrency(wh))
+
+	wh.Concurrency = 8
+	err := model.ValidateWebhookConfig([]model.WebhookConfig{wh})
+	assertErr(t, "concurrency requires a shared or keyshared subscription", err)
+
+	wh.SubscriptionType = "failover"
+	err = model.ValidateWebhookConfig([]model.WebhookConfig{wh})
+	assertErr(t, "concurrency requires a shared or keyshared subscription", err)
+
+	wh.SubscriptionType = "keyshared"
+	errNil(t, model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+	equals(t, 8, model.GetConcurrency(wh))
+
+	wh.SubscriptionType = "shared"
+	errNil(t, model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+
+	wh.Batch = &model.BatchPolicy{}
+	err = model.ValidateWebhookConfig([]model.WebhookConfig{wh})
+	assertErr(t, "concurrency cannot be combined with batch delivery", err)
+
+	wh.Batch = nil
+	wh.Concurrency = 65
+	err = model.ValidateWebhookConfig([]model.WebhookConfig{wh})
+	assertErr(t, "concurrency must be between 0 and 64", err)
+}
+
+// test webhook signing secret encryption
+func TestWebhookSigningSecret(t *testing.T) {
+	topic, err := model.NewTopicConfig("persistent://picasso/ns/topic", "pulsar+ssl://useast1.gcp.kafkaesque.io:6651", "token")
+	errNil(t, err)
+	topic.Webhooks = []model.WebhookConfig{
+		model.NewWebhookConfig("http://localhost:9000/webhook"),
+		model.NewWebhookConfig("http://localhost:9000/webhook2"),
+	}
+	topic.Webhooks[0].SigningSecret = "short"
+	_, err = model.ValidateTopicConfig(topic)
+	assertErr(t, "signing secret must be at least 16 characters", err)
+
+	topic.Webhooks[0].SigningSecret = "a-long-enough-signing-secret"
+	_, err = model.ValidateTopicConfig(topic)
+	errNil(t, err)
+
+	errNil(t, model.EncryptWebhookSecrets(&topic, nil))
+	encrypted := topic.Webhooks[0].SigningSecret
+	assert(t, encrypted != "a-long-enough-signing-secret", "signing secret is encrypted")
+	equals(t, "", topic.Webhooks[1].SigningSecret)
+
+	// an encrypted secret of the stored topic is not encrypted again
+	stored := topic
+	stored.Webhooks = append([]model.WebhookConfig{}, topic.Webhooks...)
+	errNil(t, model.EncryptWebhookSecrets(&topic, &stored))
+	equals(t, encrypted, topic.Webhooks[0].SigningSecret)
+	assertErr(t, "a webhook secret cannot start with encrypted: unless it is the stored encrypted secret", model.EncryptWebhookSecrets(&topic, nil))
+
+	secret, err := model.GetSigningSecret(topic.Webhooks[0])
+	errNil(t, err)
+	equals(t, []byte("a-long-enough-signing-secret"), secret)
+
+	secret, err = model.GetSigningSecret(topic.Webhooks[1])
+	errNil(t, err)
+	assert(t, secret == nil, "no signing secret")
+
+	// a plain text secret that happens to be a valid cipher text is still encrypted
+	cipherText, err := icrypto.EncryptWithBase64("a-long-enough-signing-secret")
+	errNil(t, err)
+	topic.Webhooks[1].SigningSecret = cipherText
+	errNil(t, model.EncryptWebhookSecrets(&topic, &stored))
+	assert(t, topic.Webhooks[1].SigningSecret != cipherText, "signing secret is encrypted")
+	secret, err = model.GetSigningSecret(topic.Webhooks[1])
+	errNil(t, err)
+	equals(t, []byte(cipherText), secret)
+
+	// a plain text secret with the encrypted prefix is rejected
+	topic.Webhooks[1].SigningSecret = "encrypted:a-long-enough-signing-secret"
+	assertErr(t, "a webhook secret cannot start with encrypted: unless it is the stored encrypted secret", model.EncryptWebhookSecrets(&topic, &stored))
+}
+
+// test webhook method, content type, and auth validation and auth secret encryption
+func TestWebhookMethodAndAuth(t *testing.T) {
+	wh := model.NewWebhookConfig("http://localhost:9000/webhook")
+	equals(t, "POST", model.GetWebhookMethod(wh))
+	wh.Method = "put"
+	equals(t, "PUT", model.GetWebhookMethod(wh))
+	errNil(t, model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+	wh.Method = "GET"
+	assertErr(t, "unsupported webhook method GET, must be POST, PUT, or PATCH", model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+
+	wh.Method = "PATCH"
+	wh.ContentType = "application/merge-patch+json; charset=utf-8"
+	errNil(t, model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+	wh.ContentType = "not a content type"
+	assertErr(t, "invalid content type not a content type", model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+	wh.ContentType = "text/plain"
+	wh.Batch = &model.BatchPolicy{}
+	assertErr(t, "a content type cannot be combined with batch delivery", model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+	wh.Batch = nil
+
+	wh.Auth = &model.WebhookAuth{Type: "digest"}
+	assertErr(t, "unsupported webhook auth type digest", model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+	wh.Auth = &model.WebhookAuth{Type: model.BasicAuth, Username: "user"}
+	assertErr(t, "basic auth requires username and password", model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+	wh.Auth = &model.WebhookAuth{Type: model.BearerAuth}
+	assertErr(t, "bearer auth requires token", model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+	wh.Auth = &model.WebhookAuth{Type: model.OAuth2Auth, TokenURL: "token", ClientID: "id", ClientSecret: "secret"}
+	assertErr(t, "oauth2 auth requires tokenUrl, clientId, and clientSecret", model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+	wh.Auth.TokenURL = "https://auth.example.com/oauth/token"
+	errNil(t, model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+	wh.Headers = []string{"authorization: Bearer static"}
+	assertErr(t, "an Authorization header cannot be combined with auth", model.ValidateWebhookConfig([]model.WebhookConfig{wh}))
+	wh.Headers = []string{}
+
+	topic, err := model.NewTopicConfig("persistent://picasso/ns/topic", "pulsar+ssl://useast1.gcp.kafkaesque.io:6651", "token")
+	errNil(t, err)
+	basic := model.NewWebhookConfig("http://localhost:9000/webhook2")
+	basic.Auth = &model.WebhookAuth{Type: model.BasicAuth, Username: "user", Password: "password"}
+	topic.Webhooks = []model.WebhookConfig{wh, basic}
+	errNil(t, model.EncryptWebhookSecrets(&topic, nil))
+	encrypted := topic.Webhooks[0].Auth.ClientSecret
+	assert(t, encrypted != "secret", "client secret is encrypted")
+	assert(t, topic.Webhooks[1].Auth.Password != "password", "password is encrypted")
+	equals(t, "user", topic.Webhooks[1].Auth.Username)
+
+	// an encrypted secret of the stored topic is not encrypted again
+	errNil(t, model.EncryptWebhookSecrets(&topic, &topic))
+	equals(t, encrypted, topic.Webhooks[0].Auth.ClientSecret)
+
+	auth, err := model.GetWebhookAuth(topic.Webhooks[0])
+	errNil(t, err)
+	equals(t, "secret", auth.ClientSecret)
+	equals(t, encrypted, topic.Webhooks[0].Auth.ClientSecret)
+	auth, err = model.GetWebhookAuth(topic.Webhooks[1])
+	errNil(t, err)
+	equals(t, "password", auth.Password)
+
+	auth, err = model.GetWebhookAuth(model.NewWebhookConfig("http://localhost:9000/webhook3"))
+	errNil(t, err)
+	assert(t, auth == nil, "no webhook auth")
+}
+
 func TestGetTopicFullNameFromRoute(t *testing.T) {
 	vars := map[string]string{"tenant": "public", "namespace": "default", "topic": "testtopic", "persistent": "np"}
 	topicFn, err := GetTopicFnFromRoute(vars)
@@ -409,3 +706,260 @@ func TestConsumerConfigFromHTTPParts(t *testing.T) {
 	_, _, _, _, _, _, err = ConsumerConfigFromHTTPParts(strings.Split("", ","), &header, vars, params)
 	errNil(t, err)
 }
+
+func TestProducerMessageFromHTTPParts(t *testing.T) {
+	header := http.Header{}
+	header.Set("PulsarKey", "key1")
+	header.Add("PulsarProperty", "region:us-east")
+	header.Set("PulsarEventTime", "2020-06-01T10:00:00Z")
+	header.Set("PulsarDeliverAfter", "30s")
+	params := map[string][]string{"orderingKey": {"order1"}, "key": {"key2"}, "property": {"tier:gold"}}
+	msg, err := ProducerMessageFromHTTPParts(&header, params, []byte("payload"))
+	errNil(t, err)
+	equals(t, "key1", msg.Key)
+	equals(t, "order1", msg.OrderingKey)
+	equals(t, "us-east", msg.Properties["region"])
+	equals(t, "gold", msg.Properties["tier"])
+	equals(t, 2020, msg.EventTime.Year())
+	equals(t, 30*time.Second, msg.DeliverAfter)
+	equals(t, "payload", string(msg.Payload))
+
+	header = http.Header{}
+	params = map[string][]string{"eventTime": {"1590000000000"}, "deliverAfter": {"1500"}}
+	msg, err = ProducerMessageFromHTTPParts(&header, params, []byte("payload"))
+	errNil(t, err)
+	equals(t, int64(1590000000), msg.EventTime.Unix())
+	equals(t, 1500*time.Millisecond, msg.DeliverAfter)
+
+	params = map[string][]string{"deliverAfter": {"1s"}, "deliverAt": {"1590000000000"}}
+	_, err = ProducerMessageFromHTTPParts(&header, params, []byte("payload"))
+	assertErr(t, "deliver after and deliver at cannot be both specified", err)
+
+	params = map[string][]string{"eventTime": {"yesterday"}}
+	_, err = ProducerMessageFromHTTPParts(&header, params, []byte("payload"))
+	assertErr(t, "invalid event time yesterday", err)
+
+	params = map[string][]string{"property": {"novalue"}}
+	_, err = ProducerMessageFromHTTPParts(&header, params, []byte("payload"))
+	assertErr(t, "invalid property novalue, the format is name:value", err)
+}
+
+// test the property names set in HTTP headers are kept as is and matched by a webhook filter
+func TestHeaderPropertyFilter(t *testing.T) {
+	header := http.Header{}
+	header.Add("PulsarProperty", "orderId:1001")
+	header.Add("PulsarProperty", "x-region:eu")
+	params := url.Values{"property": {"priority:7", "orderId:1000"}}
+	msg, err := ProducerMessageFromHTTPParts(&header, params, []byte(`{"amount": 10}`))
+	errNil(t, err)
+	equals(t, map[string]string{"orderId": "1001", "x-region": "eu", "priority": "7"}, msg.Properties)
+
+	filter, err := model.ParseFilter(`properties.orderId == 1001 && properties['x-region'] == 'eu' && properties.priority > 5`)
+	errNil(t, err)
+	assert(t, filter.Match(msg.Key, msg.Properties, msg.Payload), "a filter matches the property names set in headers")
+
+	filter, err = model.ParseFilter(`properties.orderid == 1001`)
+	errNil(t, err)
+	assert(t, !filter.Match(msg.Key, msg.Properties, msg.Payload), "a property name is case sensitive")
+
+	header = http.Header{}
+	header.Set("PulsarProperty-orderId", "1001")
+	_, err = ProducerMessageFromHTTPParts(&header, url.Values{}, nil)
+	assertErr(t, "unsupported header Pulsarproperty-Orderid, a property is set by the header PulsarProperty in the name:value format", err)
+
+	header = http.Header{}
+	header.Add("PulsarProperty", "novalue")
+	_, err = ProducerMessageFromHTTPParts(&header, url.Values{}, nil)
+	assertErr(t, "invalid property novalue, the format is name:value", err)
+}
+
+func TestAsyncSendStatusHandler(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/v2/firehose/status/unknown-id", nil)
+	errNil(t, err)
+	req = mux.SetURLVars(req, map[string]string{"pulsarBeamId": "unknown-id"})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(AsyncSendStatusHandler).ServeHTTP(rr, req)
+	equals(t, http.StatusNotFound, rr.Code)
+}
+
+func TestIdempotencyKeyReceiverHandler(t *testing.T) {
+	vars := map[string]string{"persistent": "p", "tenant": "tenant", "namespace": "ns", "topic": "tc"}
+
+	req, err := http.NewRequest(http.MethodPost, "/v2/firehose/p/tenant/ns/tc?mode=async", bytes.NewReader([]byte("payload")))
+	errNil(t, err)
+	req.Header.Set("PulsarUrl", "pulsar://localhost:6650")
+	req.Header.Set(IdempotencyKeyHeader, "order-1234")
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(ReceiveHandler).ServeHTTP(rr, req)
+	equals(t, http.StatusUnprocessableEntity, rr.Code)
+	assert(t, strings.Contains(rr.Body.String(), "not supported in async mode"), "")
+
+	req, err = http.NewRequest(http.MethodPost, "/v2/firehose/p/tenant/ns/tc", bytes.NewReader([]byte("payload")))
+	errNil(t, err)
+	req.Header.Set("PulsarUrl", "pulsar://localhost:6650")
+	req.Header.Set(IdempotencyKeyHeader, strings.Repeat("k", 256))
+	req = mux.SetURLVars(req, vars)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(ReceiveHandler).ServeHTTP(rr, req)
+	equals(t, http.StatusUnprocessableEntity, rr.Code)
+	assert(t, strings.Contains(rr.Body.String(), "exceeds the max length"), "")
+}
+
+func TestWebSocketHandler(t *testing.T) {
+	vars := map[string]string{"persistent": "p", "tenant": "tenant", "namespace": "ns", "topic": "tc"}
+
+	req, err := http.NewRequest(http.MethodGet, "/v2/ws/p/tenant/ns/tc?permits=20000", nil)
+	errNil(t, err)
+	req.Header.Set("PulsarUrl", "pulsar://localhost:6650")
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(WebSocketHandler).ServeHTTP(rr, req)
+	equals(t, http.StatusUnprocessableEntity, rr.Code)
+
+	req, err = http.NewRequest(http.MethodGet, "/v2/ws/p/tenant/ns/tc", nil)
+	errNil(t, err)
+	req.Header.Set("PulsarUrl", "pulsar://localhost:6650")
+	req = mux.SetURLVars(req, vars)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(WebSocketHandler).ServeHTTP(rr, req)
+	equals(t, http.StatusBadRequest, rr.Code)
+
+	// a browser origin is rejected unless it is allowed by the config
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Origin", "https://evil.example.com")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(WebSocketHandler).ServeHTTP(rr, req)
+	equals(t, http.StatusForbidden, rr.Code)
+}
+
+func TestSSEHandlerLastEventID(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/v2/sse/p/tenant/ns/tc", nil)
+	errNil(t, err)
+	req.Header.Set("PulsarUrl", "pulsar://localhost:6650")
+	req.Header.Set("Last-Event-ID", "not-a-message-id")
+	req = mux.SetURLVars(req, map[string]string{"persistent": "p", "tenant": "tenant", "namespace": "ns", "topic": "tc"})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(SSEHandler).ServeHTTP(rr, req)
+	equals(t, http.StatusUnprocessableEntity, rr.Code)
+	assert(t, strings.Contains(rr.Body.String(), "invalid message id not-a-message-id"), "")
+}
+
+func TestPollHandlerOptions(t *testing.T) {
+	vars := map[string]string{"persistent": "p", "tenant": "tenant", "namespace": "ns", "topic": "tc"}
+	poll := func(query string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/v2/poll/p/tenant/ns/tc?"+query, nil)
+		errNil(t, err)
+		req.Header.Set("PulsarUrl", "pulsar://localhost:6650")
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(PollHandler).ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := poll("waitMs=30001")
+	equals(t, http.StatusUnprocessableEntity, rr.Code)
+	assert(t, strings.Contains(rr.Body.String(), "waitMs must be between 0 and 30000"), "")
+
+	rr = poll("batchSize=0")
+	equals(t, http.StatusUnprocessableEntity, rr.Code)
+
+	rr = poll("autoAck=false")
+	equals(t, http.StatusUnprocessableEntity, rr.Code)
+	assert(t, strings.Contains(rr.Body.String(), "SubscriptionName is required to acknowledge messages by receipt handles"), "")
+
+	rr = poll("SubscriptionName=durable-sub&autoAck=false&visibilityTimeoutMs=0")
+	equals(t, http.StatusUnprocessableEntity, rr.Code)
+	assert(t, strings.Contains(rr.Body.String(), "visibilityTimeoutMs must be between 1 and 43200000"), "")
+}
+
+func TestAckHandler(t *testing.T) {
+	vars := map[string]string{"persistent": "p", "tenant": "tenant", "namespace": "ns", "topic": "tc"}
+	ack := func(handler http.HandlerFunc, query, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, "/v2/ack/p/tenant/ns/tc?"+query, bytes.NewBufferString(body))
+		errNil(t, err)
+		req.Header.Set("PulsarUrl", "pulsar://localhost:6650")
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := ack(AckHandler, "", `{"receiptHandles": ["handle1"]}`)
+	equals(t, http.StatusUnprocessableEntity, rr.Code)
+	assert(t, strings.Contains(rr.Body.String(), "SubscriptionName is required"), "")
+
+	rr = ack(AckHandler, "SubscriptionName=durable-sub", `{"receiptHandles": []}`)
+	equals(t, http.StatusUnprocessableEntity, rr.Code)
+
+	// the receipt handles are unknown since the subscription has never been polled
+	rr = ack(NackHandler, "SubscriptionName=durable-sub", `{"receiptHandles": ["handle1", "handle2"]}`)
+	equals(t, http.StatusOK, rr.Code)
+	var res model.AckResponse
+	errNil(t, json.Unmarshal(rr.Body.Bytes(), &res))
+	equals(t, 0, len(res.Succeeded))
+	equals(t, []string{"handle1", "handle2"}, res.Failed)
+}
+
+func TestSeekRequest(t *testing.T) {
+	errNil(t, model.ValidateSeekRequest(model.SeekRequest{Position: model.SeekEarliest}))
+	now := time.Now()
+	errNil(t, model.ValidateSeekRequest(model.SeekRequest{Timestamp: &now}))
+	errNil(t, model.ValidateSeekRequest(model.SeekRequest{MessageID: model.MessageIDString(pulsar.EarliestMessageID())}))
+
+	assertErr(t, "exactly one of position, timestamp, and messageId is required", model.ValidateSeekRequest(model.SeekRequest{}))
+	assertErr(t, "exactly one of position, timestamp, and messageId is required", model.ValidateSeekRequest(model.SeekRequest{Position: model.SeekLatest, Timestamp: &now}))
+	assertErr(t, "unsupported position middle, supported positions are earliest and latest", model.ValidateSeekRequest(model.SeekRequest{Position: "middle"}))
+	assert(t, model.ValidateSeekRequest(model.SeekRequest{MessageID: "not-a-message-id"}) != nil, "")
+}
+
+func TestSeekSubscriptionHandler(t *testing.T) {
+	vars := map[string]string{"persistent": "p", "tenant": "picasso", "namespace": "ns", "topic": "tc"}
+	seek := func(query, subs, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, "/v2/seek/p/picasso/ns/tc?"+query, bytes.NewBufferString(body))
+		errNil(t, err)
+		req.Header.Set("PulsarUrl", "pulsar://localhost:6650")
+		req.Header.Set("injectedSubs", subs)
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(SeekSubscriptionHandler).ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := seek("", "picasso", `{"position": "earliest"}`)
+	equals(t, http.StatusUnprocessableEntity, rr.Code)
+	assert(t, strings.Contains(rr.Body.String(), "SubscriptionName is required"), "")
+
+	rr = seek("SubscriptionName=durable-sub", "picasso", `{"position": "earliest", "messageId": "CAwQBTAA"}`)
+	equals(t, http.StatusUnprocessableEntity, rr.Code)
+
+	rr = seek("SubscriptionName=durable-sub", "another-tenant", `{"position": "latest"}`)
+	equals(t, http.StatusForbidden, rr.Code)
+}
+
+func TestReadHandlerOptions(t *testing.T) {
+	read := func(query string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/v2/read/p/tenant/ns/tc?"+query, nil)
+		errNil(t, err)
+		req.Header.Set("PulsarUrl", "pulsar://localhost:6650")
+		req = mux.SetURLVars(req, map[string]string{"persistent": "p", "tenant": "tenant", "namespace": "ns", "topic": "tc"})
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(ReadHandler).ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := read("batchSize=1001")
+	equals(t, http.StatusUnprocessableEntity, rr.Code)
+	assert(t, strings.Contains(rr.Body.String(), "batchSize must be between 1 and 1000"), "")
+
+	rr = read("cursor=CAwQBTAA&startTime=1590000000000")
+	equals(t, http.StatusUnprocessableEntity, rr.Code)
+	assert(t, strings.Contains(rr.Body.String(), "only one of cursor, startMessageId, and startTime can be specified"), "")
+
+	rr = read("startMessageId=not-a-message-id")
+	equals(t, http.StatusUnprocessableEntity, rr.Code)
+
+	rr = read("startTime=yesterday")
+	equals(t, http.StatusUnprocessableEntity, rr.Code)
+}
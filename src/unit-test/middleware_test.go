@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -98,21 +100,139 @@ func TestNoAuthMiddleware(t *testing.T) {
 }
 
 func TestRateLimitMiddleware(t *testing.T) {
-	handlerTest := LimitRate(http.HandlerFunc(mockHandler))
+	limiter := NewRateLimiter(RateLimit{Rate: 1, Burst: 2}, map[string]RateLimit{"unlimited": {Rate: 0, Burst: 1}})
+	handlerTest := limiter.Limit("test")(http.HandlerFunc(mockHandler))
 
 	req, err := http.NewRequest(http.MethodGet, "http://test", nil)
 	errNil(t, err)
+	req = WithSubjects(req, "picasso")
 
-	request := func() {
+	rr := httptest.NewRecorder()
+	handlerTest.ServeHTTP(rr, req)
+	equals(t, http.StatusOK, rr.Code)
+	equals(t, "2", rr.Header().Get("X-RateLimit-Limit"))
+	equals(t, "1", rr.Header().Get("X-RateLimit-Remaining"))
+
+	rr = httptest.NewRecorder()
+	handlerTest.ServeHTTP(rr, req)
+	equals(t, http.StatusOK, rr.Code)
+	equals(t, "0", rr.Header().Get("X-RateLimit-Remaining"))
+
+	// the burst is exhausted
+	rr = httptest.NewRecorder()
+	handlerTest.ServeHTTP(rr, req)
+	equals(t, http.StatusTooManyRequests, rr.Code)
+	equals(t, "1", rr.Header().Get("Retry-After"))
+
+	// another tenant has its own bucket
+	req = WithSubjects(req, "matisse")
+	rr = httptest.NewRecorder()
+	handlerTest.ServeHTTP(rr, req)
+	equals(t, http.StatusOK, rr.Code)
+
+	// the route with zero rate is not limited
+	unlimited := limiter.Limit("unlimited")(http.HandlerFunc(mockHandler))
+	for i := 0; i < 10; i++ {
+		rr = httptest.NewRecorder()
+		unlimited.ServeHTTP(rr, req)
+		equals(t, http.StatusOK, rr.Code)
+	}
+}
+
+func TestRateLimitSpoofedSubjects(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{Rate: 1, Burst: 2}, nil)
+	handlerTest := NoAuth(limiter.Limit("test")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		equals(t, "", r.Header.Get("injectedSubs"))
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	// a rotated injectedSubs header does not get a new bucket on a route without JWT verification
+	codes := []int{}
+	for _, subs := range []string{"picasso", "matisse", "monet"} {
+		req, err := http.NewRequest(http.MethodGet, "http://test", nil)
+		errNil(t, err)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("injectedSubs", subs)
 		rr := httptest.NewRecorder()
 		handlerTest.ServeHTTP(rr, req)
-		equals(t, http.StatusOK, rr.Code)
+		codes = append(codes, rr.Code)
 	}
-	//
-	for i := 0; i < 1000; i++ {
-		go request()
+	equals(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+
+	// the requests failing authentication are limited per client IP address
+	failing := limiter.LimitAuthFailures("test")(AuthHeaderRequired(limiter.Limit("test")(http.HandlerFunc(mockHandler))))
+	codes = []int{}
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest(http.MethodGet, "http://test", nil)
+		errNil(t, err)
+		req.RemoteAddr = "10.0.0.2:1234"
+		rr := httptest.NewRecorder()
+		failing.ServeHTTP(rr, req)
+		codes = append(codes, rr.Code)
 	}
+	equals(t, []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}, codes)
+}
 
+func TestRateLimitConcurrentAuthFailures(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{Rate: 0.001, Burst: 2}, nil)
+	release := make(chan struct{})
+	var passed int32
+	failing := limiter.LimitAuthFailures("test")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&passed, 1)
+		<-release
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	// the concurrent requests in flight cannot pass on the same tokens
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodGet, "http://test", nil)
+			req.RemoteAddr = "10.0.0.3:1234"
+			failing.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	equals(t, int32(2), atomic.LoadInt32(&passed))
+
+	// the authenticated requests do not use the tokens of the auth failures
+	authenticated := limiter.Limit("ok")(http.HandlerFunc(mockHandler))
+	handler := limiter.LimitAuthFailures("ok")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		authenticated.ServeHTTP(w, r)
+	}))
+	codes := []int{}
+	for _, auth := range []string{"Bearer t", "Bearer t", "", "", ""} {
+		req, err := http.NewRequest(http.MethodGet, "http://test", nil)
+		errNil(t, err)
+		req.RemoteAddr = "10.0.0.4:1234"
+		req.Header.Set("Authorization", auth)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		codes = append(codes, rr.Code)
+	}
+	equals(t, []int{http.StatusOK, http.StatusOK, http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}, codes)
+}
+
+func TestParseRouteRateLimits(t *testing.T) {
+	limits, err := ParseRouteRateLimits("Receive=500:1000, http-sse=0.5")
+	errNil(t, err)
+	equals(t, RateLimit{Rate: 500, Burst: 1000}, limits["Receive"])
+	equals(t, RateLimit{Rate: 0.5, Burst: 1}, limits["http-sse"])
+
+	limits, err = ParseRouteRateLimits("")
+	errNil(t, err)
+	equals(t, 0, len(limits))
+
+	_, err = ParseRouteRateLimits("Receive=fast")
+	assertErr(t, "invalid route rate limit Receive=fast", err)
 }
 
 func TestLoggerMiddleware(t *testing.T) {
@@ -151,24 +271,3 @@ func TestAuthJWTMiddlewareWithNoAuth(t *testing.T) {
 	equals(t, "thisisroot", req.Header.Get("injectedSubs"))
 	equals(t, http.StatusOK, rr.Code)
 }
-
-func TestSemaphore(t *testing.T) {
-	var sema = NewSema(2)
-	err := sema.Release()
-	equals(t, "all semaphore buffer empty", err.Error())
-
-	err = sema.Acquire()
-	errNil(t, err)
-	sema.Acquire()
-	err = sema.Acquire()
-	assertErr(t, "all semaphore buffer full", err)
-
-	sema.Release()
-	errNil(t, sema.Acquire())
-
-	errNil(t, sema.Release())
-	errNil(t, sema.Release())
-
-	err = sema.Release()
-	assertErr(t, "all semaphore buffer empty", err)
-}
@@ -1,8 +1,11 @@
 package tests
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
+	"github.com/apache/pulsar-client-go/pulsar"
 	. "github.com/kafkaesque-io/pulsar-beam/src/model"
 )
 
@@ -12,3 +15,194 @@ func TestPulsarMessages(t *testing.T) {
 	equals(t, messages.Limit, 10)
 	equals(t, messages.IsEmpty(), true)
 }
+
+func TestParseFirehoseMessages(t *testing.T) {
+	msgs, err := ParseFirehoseMessages([]byte(`[{"payload": {"a": 1}, "key": "k1"}, {"payloadBase64": "aGVsbG8=", "properties": {"p": "v"}}]`))
+	errNil(t, err)
+	equals(t, 2, len(msgs))
+	equals(t, `{"a": 1}`, string(msgs[0].Data()))
+	equals(t, "k1", msgs[0].Key)
+	equals(t, "hello", string(msgs[1].Data()))
+	equals(t, "v", msgs[1].Properties["p"])
+
+	msgs, err = ParseFirehoseMessages([]byte("{\"payload\": \"text\"}\n{\"payload\": 2, \"eventTime\": \"2020-01-02T15:04:05Z\"}\n"))
+	errNil(t, err)
+	equals(t, 2, len(msgs))
+	equals(t, `"text"`, string(msgs[0].Data()))
+	equals(t, 2020, msgs[1].EventTime.Year())
+
+	_, err = ParseFirehoseMessages([]byte("[]"))
+	assertErr(t, "no message in the batch", err)
+
+	_, err = ParseFirehoseMessages([]byte(`[{"key": "k1"}]`))
+	assertErr(t, "message at index 0 has no payload", err)
+
+	_, err = ParseFirehoseMessages([]byte(`[{"payload": 1, "payloadBase64": "aGVsbG8="}]`))
+	assertErr(t, "message at index 0 cannot have both payload and payloadBase64", err)
+
+	_, err = ParseFirehoseMessages([]byte("{\"payload\": 1}\nnot json"))
+	assert(t, err != nil, "invalid newline delimited JSON")
+}
+
+func TestMessageIDString(t *testing.T) {
+	id, err := ParseMessageID(MessageIDString(pulsar.EarliestMessageID()))
+	errNil(t, err)
+	equals(t, pulsar.EarliestMessageID().LedgerID(), id.LedgerID())
+	equals(t, pulsar.EarliestMessageID().EntryID(), id.EntryID())
+
+	_, err = ParseMessageID("not-base64")
+	assertErr(t, "invalid message id not-base64", err)
+}
+
+func TestFirehoseResponse(t *testing.T) {
+	res := NewFirehoseResponse(pulsar.EarliestMessageID(), "beam-id", 1500*time.Microsecond)
+	equals(t, MessageIDString(pulsar.EarliestMessageID()), res.MessageID)
+	equals(t, pulsar.EarliestMessageID().LedgerID(), res.LedgerID)
+	equals(t, "beam-id", res.PulsarBeamID)
+	equals(t, 1.5, res.LatencyMs)
+
+	// async mode has no message id
+	res = NewFirehoseResponse(nil, "beam-id", time.Millisecond)
+	equals(t, "", res.MessageID)
+	equals(t, 1.0, res.LatencyMs)
+}
+
+func TestTopicSchema(t *testing.T) {
+	definition := `{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "long"}, {"name": "note", "type": ["null", "string"], "default": null}]}`
+
+	topic, err := NewTopicConfig("persistent://picasso/local-useast1-gcp/orders", "pulsar://mydomain.net:6650", "")
+	errNil(t, err)
+	topic.Schema = &TopicSchema{Type: "protobuf", Definition: definition}
+	_, err = ValidateTopicConfig(topic)
+	assertErr(t, "unsupported schema type protobuf, supported types are json and avro", err)
+	topic.Schema = &TopicSchema{Type: "avro", Definition: `{"type": "record"}`}
+	_, err = ValidateTopicConfig(topic)
+	assert(t, err != nil, "invalid schema definition")
+	topic.Schema = &TopicSchema{Type: "avro", Definition: definition}
+	_, err = ValidateTopicConfig(topic)
+	errNil(t, err)
+
+	avro := topic.Schema
+	encoded, err := avro.Encode([]byte(`{"id": 7, "note": "gift"}`))
+	errNil(t, err)
+	assert(t, string(encoded) != `{"id": 7, "note": "gift"}`, "avro payload must be binary encoded")
+	decoded, err := avro.Decode(encoded)
+	errNil(t, err)
+	// the field order of a decoded record is not deterministic
+	var order map[string]interface{}
+	errNil(t, json.Unmarshal(decoded, &order))
+	equals(t, map[string]interface{}{"id": float64(7), "note": map[string]interface{}{"string": "gift"}}, order)
+	_, err = avro.Encode([]byte(`{"note": "no id"}`))
+	assert(t, err != nil, "missing field must fail the validation")
+	equals(t, pulsar.AVRO, avro.PulsarSchema().GetSchemaInfo().Type)
+
+	jsonSchema := &TopicSchema{Type: "json", Definition: definition}
+	encoded, err = jsonSchema.Encode([]byte(`{"id": 7}`))
+	errNil(t, err)
+	equals(t, `{"id": 7}`, string(encoded))
+	_, err = jsonSchema.Encode([]byte(`{"id": "seven"}`))
+	assert(t, err != nil, "wrong field type must fail the validation")
+	equals(t, pulsar.JSON, jsonSchema.PulsarSchema().GetSchemaInfo().Type)
+
+	var none *TopicSchema
+	encoded, err = none.Encode([]byte("raw"))
+	errNil(t, err)
+	equals(t, "raw", string(encoded))
+	assert(t, none.PulsarSchema() == nil, "")
+}
+
+func TestWebSocketRequest(t *testing.T) {
+	var req WebSocketRequest
+	errNil(t, json.Unmarshal([]byte(`{"type": "publish", "context": "c1", "payload": {"a": 1}, "key": "k1", "properties": {"p": "v"}}`), &req))
+	equals(t, WebSocketPublish, req.Type)
+	equals(t, "c1", req.Context)
+	equals(t, `{"a": 1}`, string(req.Data()))
+	equals(t, "k1", req.Key)
+	equals(t, "v", req.Properties["p"])
+
+	errNil(t, json.Unmarshal([]byte(`{"type": "flow", "permits": 50}`), &req))
+	equals(t, WebSocketFlow, req.Type)
+	equals(t, 50, req.Permits)
+}
+
+func TestMessageFilter(t *testing.T) {
+	props := map[string]string{"region": "us", "priority": "7", "x.y": "dotted"}
+	payload := []byte(`{"amount": 120, "status": "paid", "items": [{"sku": "a1"}], "note": null, "gift": false}`)
+	match := func(expr string) bool {
+		f, err := ParseFilter(expr)
+		errNil(t, err)
+		return f.Match("order-1", props, payload)
+	}
+
+	assert(t, match(`key == 'order-1'`), "")
+	assert(t, match(`properties.region == "us" && payload.amount >= 100`), "")
+	assert(t, match(`properties.priority > 5`), "a property is compared as a number with a number literal")
+	assert(t, match(`properties['x.y'] == 'dotted'`), "")
+	assert(t, match(`payload.items.0.sku == 'a1'`), "")
+	assert(t, match(`payload.status != 'refunded' || payload.amount < 10`), "")
+	assert(t, match(`!(payload.status == 'refunded') && payload.gift == false`), "")
+	assert(t, match(`payload.note == null && payload.missing == null`), "a missing field equals null")
+	assert(t, match(`properties.missing != 'eu'`), "")
+	assert(t, match(`payload.gift`), "a false field exists")
+	assert(t, !match(`payload.note`), "a null field does not exist")
+	assert(t, !match(`payload.amount == '120'`), "different types are not equal")
+	assert(t, !match(`payload.status > 5`), "")
+	assert(t, !match(`key == 'order-2' || properties.region == 'eu'`), "")
+	assert(t, !match(`properties.REGION == 'us'`), "a property name is case sensitive")
+
+	f, err := ParseFilter(`payload.status == 'paid'`)
+	errNil(t, err)
+	assert(t, f.UsesPayload(), "")
+	assert(t, !f.Match("", nil, []byte("not json")), "a payload that is not JSON has no field")
+
+	f, err = ParseFilter(" ")
+	errNil(t, err)
+	assert(t, f == nil && f.Match("", nil, nil), "an empty filter matches any message")
+
+	for _, expr := range []string{`key ==`, `key = 'a'`, `value == 1`, `properties.a.b == 1`, `(key == 'a'`, `key == 'a`, `key == 'a' key`, `payload[a] == 1`} {
+		_, err = ParseFilter(expr)
+		assert(t, err != nil, "invalid filter "+expr)
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	r, err := CompileWebhookTemplate(&WebhookTemplate{
+		Body:    `{"text": {{json (printf "order %v from %s" .Payload.id .Properties.region)}}, "topic": "{{.Topic}}"}`,
+		Headers: []string{"X-Order-Key: {{.Key}}", "X-Note:{{.Payload.note}}"},
+	})
+	errNil(t, err)
+	var payload interface{}
+	errNil(t, json.Unmarshal([]byte(`{"id": 7, "note": "line1\nline2"}`), &payload))
+	body, headers, err := r.Render(TemplateData{
+		Payload:    payload,
+		Key:        "k1",
+		Properties: map[string]string{"region": "us"},
+		Topic:      "persistent://ten/ns/orders",
+	})
+	errNil(t, err)
+	equals(t, string(body), `{"text": "order 7 from us", "topic": "persistent://ten/ns/orders"}`)
+	equals(t, headers, []string{"X-Order-Key:k1", "X-Note:line1 line2"})
+
+	r, err = CompileWebhookTemplate(&WebhookTemplate{Headers: []string{"X-Key:{{.Key}}"}})
+	errNil(t, err)
+	body, _, err = r.Render(TemplateData{})
+	errNil(t, err)
+	assert(t, body == nil, "the payload is kept without a body template")
+
+	r, err = CompileWebhookTemplate(nil)
+	errNil(t, err)
+	assert(t, r == nil, "")
+
+	for _, tmpl := range []WebhookTemplate{{Body: "{{.Key"}, {Headers: []string{"X-Key"}}, {Headers: []string{"Bad Name:{{.Key}}"}}, {Headers: []string{"X-Key:{{end}}"}}} {
+		_, err = CompileWebhookTemplate(&tmpl)
+		assert(t, err != nil, "invalid template")
+	}
+
+	wh := NewWebhookConfig("http://localhost/template")
+	wh.Template = &WebhookTemplate{Body: "{{.Payload"}
+	assert(t, ValidateWebhookConfig([]WebhookConfig{wh}) != nil, "an invalid template fails the validation")
+	wh.Template = &WebhookTemplate{Body: "{{.Payload}}"}
+	errNil(t, ValidateWebhookConfig([]WebhookConfig{wh}))
+	wh.Batch = &BatchPolicy{}
+	assert(t, ValidateWebhookConfig([]WebhookConfig{wh}) != nil, "a template cannot be combined with batch delivery")
+}
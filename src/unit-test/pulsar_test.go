@@ -36,7 +36,7 @@ func TestProducerObject(t *testing.T) {
 	os.Setenv("PulsarClientOperationTimeout", "1")
 	os.Setenv("PulsarClientConnectionTimeout", "1")
 
-	_, err := pulsardriver.GetPulsarProducer("pulsar://test url", "tokenstring", "topicName")
+	_, err := pulsardriver.GetPulsarProducer("pulsar://test url", "tokenstring", "topicName", nil)
 	assert(t, err != nil, "create pulsar consumer with bogus url")
 
 	// pulsardriver.SendToPulsar("pulsar://", "tokenstring", "topicName", []byte("payload"), false)
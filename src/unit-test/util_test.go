@@ -273,6 +273,35 @@ func TestExpiryTTLCache(t *testing.T) {
 
 }
 
+func TestCloseTTLCache(t *testing.T) {
+
+	cache := NewCache(CacheOption{
+		TTL:           time.Minute,
+		CleanInterval: time.Minute,
+		ExpireCallback: func(key string, value interface{}) {
+			if obj, ok := value.(*TestObj); ok {
+				obj.Close()
+			} else {
+				assert(t, false, "wrong object type stored in Cache")
+			}
+		},
+	})
+
+	object1 := TestObj{}
+	cache.Set("object1", &object1)
+	object2 := TestObj{}
+	cache.Set("object2", &object2)
+	assert(t, 2 == cache.Count(), "check the counts of total number of objects in cache")
+
+	cache.Close()
+	assert(t, 0 == cache.Count(), "all objects are purged on close")
+	assert(t, object1.isClosed, "object1 has been Close() by the callback")
+	assert(t, object2.isClosed, "object2 has been Close() by the callback")
+
+	// close is idempotent
+	cache.Close()
+}
+
 func TestInfinityExpiryTTLCache(t *testing.T) {
 
 	cache := NewCache(CacheOption{
@@ -315,6 +344,50 @@ func TestInfinityExpiryTTLCache(t *testing.T) {
 	cache.Close()
 }
 
+func TestMaxSizeTTLCache(t *testing.T) {
+
+	evicted := []string{}
+	cache := NewCache(CacheOption{
+		TTL:           20 * time.Millisecond,
+		CleanInterval: time.Minute,
+		ExpireCallback: func(key string, value interface{}) {
+			evicted = append(evicted, key)
+		},
+		MaxSize:  2,
+		FixedTTL: true,
+	})
+	defer cache.Close()
+
+	cache.Set("object1", 1)
+	cache.Set("object2", 2)
+	// setting an existing key does not evict and makes it the most recently set
+	cache.Set("object1", 11)
+	equals(t, 2, cache.Count())
+	equals(t, 0, len(evicted))
+
+	cache.Set("object3", 3)
+	equals(t, 2, cache.Count())
+	equals(t, []string{"object2"}, evicted)
+	_, ok := cache.Get("object2")
+	assert(t, !ok, "object2 is evicted as the least recently set")
+	obj, ok := cache.Get("object1")
+	assert(t, ok, "object1 is kept")
+	equals(t, 11, obj.(int))
+
+	cache.Delete("object3")
+	cache.Set("object4", 4)
+	equals(t, 2, cache.Count())
+	equals(t, []string{"object2", "object3"}, evicted)
+
+	// Get does not extend the expiry with a fixed TTL
+	for i := 0; i < 5; i++ {
+		time.Sleep(5 * time.Millisecond)
+		cache.Get("object1")
+	}
+	_, ok = cache.Get("object1")
+	assert(t, !ok, "object1 has expired despite the reads")
+}
+
 func TestConcurrencyTTLCache(t *testing.T) {
 
 	cache := NewCache(CacheOption{
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"container/list"
 	"time"
 )
 
@@ -25,6 +26,8 @@ type item struct {
 	data     interface{}
 	ttl      time.Duration
 	expireAt time.Time
+	// elem is the position in the order of the cache with a max size
+	elem *list.Element
 }
 
 // Reset the item expiration time
@@ -81,6 +81,48 @@ type Configuration struct {
 
 	// HTTPAuthImpl specifies the jwt authen and authorization algorithm, `noauth` to skip JWT authentication
 	HTTPAuthImpl string `json:"HTTPAuthImpl"`
+
+	// WebhookSuspendFailures is the number of consecutive delivery failures to suspend a webhook
+	// default value 0 disables the suspension
+	WebhookSuspendFailures string `json:"WebhookSuspendFailures"`
+
+	// WebhookProbeInterval is the interval the webhook brokers probe a suspended webhook
+	// default value 60s
+	WebhookProbeInterval string `json:"WebhookProbeInterval"`
+
+	// WebhookStatsInterval is the interval the webhook brokers write the webhook delivery stats to the database
+	// default value 10s
+	WebhookStatsInterval string `json:"WebhookStatsInterval"`
+
+	// ShutdownTimeout is the deadline to drain HTTP requests and in-flight webhook deliveries on SIGTERM or SIGINT
+	// default value 25s, shorter than the default Kubernetes termination grace period
+	ShutdownTimeout string `json:"ShutdownTimeout"`
+
+	// RateLimitPerSecond is the token bucket refill rate of requests per second per tenant on every route
+	// default value 0 disables the rate limit
+	RateLimitPerSecond string `json:"RateLimitPerSecond"`
+
+	// RateLimitBurst is the token bucket size, the max number of requests in a burst
+	// default value 200
+	RateLimitBurst string `json:"RateLimitBurst"`
+
+	// RateLimitRoutes overrides the rate limit of routes by route names
+	// It is a comma separated string in the format of `<route name>=<rate per second>:<burst>`
+	RateLimitRoutes string `json:"RateLimitRoutes"`
+
+	// WebSocketAllowedOrigins is a comma separated list of the origins allowed to open a WebSocket connection,
+	// such as `https://app.example.com`, and `*` allows any origin. A connection without the Origin header is
+	// always allowed since it is not opened by a browser.
+	// default value empty rejects every connection with the Origin header
+	WebSocketAllowedOrigins string `json:"WebSocketAllowedOrigins"`
+
+	// SSEKeepAliveInterval is the interval to send a keep-alive comment on an idle SSE stream
+	// default value 15s, 0s disables the keep-alive
+	SSEKeepAliveInterval string `json:"SSEKeepAliveInterval"`
+
+	// SSERetry is the reconnection time sent to SSE clients in the retry field
+	// default value 3s, 0s leaves the reconnection time to the client
+	SSERetry string `json:"SSERetry"`
 }
 
 var (
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"container/list"
 	"sync"
 	"time"
 )
@@ -15,6 +16,8 @@ type Cache struct {
 	items          map[string]*item
 	shutdownSignal chan (chan struct{})
 	isShutDown     bool
+	// order keeps the keys from the least to the most recently set, only if MaxSize is specified
+	order *list.List
 }
 
 // CacheOption is the optional configuration for Cache
@@ -22,6 +25,11 @@ type CacheOption struct {
 	TTL            time.Duration
 	CleanInterval  time.Duration
 	ExpireCallback expireCallback
+	// MaxSize caps the number of items, the least recently set item is evicted to add a new one
+	// no cap if it is not specified
+	MaxSize int
+	// FixedTTL keeps an item's expiry time on Get, otherwise Get extends the expiry time by the TTL
+	FixedTTL bool
 }
 
 // Get gets an object from the cache
@@ -35,14 +43,13 @@ func (c *Cache) Get(key string) (interface{}, bool) {
 
 	if item.expired() {
 		c.mutex.Lock()
-		c.opt.ExpireCallback(key, item.data)
-		delete(c.items, key)
+		c.remove(key, item)
 		c.mutex.Unlock()
 		return nil, false
 	}
 
 	// item has no expiration
-	if item.ttl < 0 {
+	if item.ttl < 0 || c.opt.FixedTTL {
 		return item.data, true
 	}
 
@@ -74,17 +81,46 @@ func (c *Cache) eventLoop() {
 			for _, keyValue := range keys {
 				c.mutex.Lock()
 				if item, ok := c.items[keyValue]; ok && item.expired() {
-					c.opt.ExpireCallback(keyValue, item.data)
-					delete(c.items, keyValue)
+					c.remove(keyValue, item)
 				}
 				c.mutex.Unlock()
 			}
+		case done := <-c.shutdownSignal:
+			close(done)
+			return
 		}
 	}
 }
 
-// Close is not implmented yet
-func (c *Cache) Close() {}
+// Close stops the clean up loop and invokes the expire callback on every item left in the cache
+func (c *Cache) Close() {
+	c.mutex.Lock()
+	if c.isShutDown {
+		c.mutex.Unlock()
+		return
+	}
+	c.isShutDown = true
+	c.mutex.Unlock()
+
+	done := make(chan struct{})
+	c.shutdownSignal <- done
+	<-done
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key, item := range c.items {
+		c.remove(key, item)
+	}
+}
+
+// remove invokes the expire callback and deletes an item, the caller must hold the write lock
+func (c *Cache) remove(key string, item *item) {
+	c.opt.ExpireCallback(key, item.data)
+	delete(c.items, key)
+	if item.elem != nil {
+		c.order.Remove(item.elem)
+	}
+}
 
 // Set adds a new item with a gobally set TTL by the cache
 func (c *Cache) Set(key string, data interface{}) {
@@ -98,8 +134,17 @@ func (c *Cache) SetWithTTL(key string, data interface{}, ttl time.Duration) {
 	}
 	item := newItem(key, data, ttl)
 	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.order != nil {
+		if old, ok := c.items[key]; ok {
+			c.order.Remove(old.elem)
+		} else if len(c.items) >= c.opt.MaxSize {
+			oldest := c.order.Front().Value.(string)
+			c.remove(oldest, c.items[oldest])
+		}
+		item.elem = c.order.PushBack(key)
+	}
 	c.items[key] = item
-	c.mutex.Unlock()
 }
 
 // Delete deletes an item with the key specified
@@ -109,8 +154,7 @@ func (c *Cache) Delete(key string) {
 	defer c.mutex.Unlock()
 
 	if item, ok := c.items[key]; ok {
-		c.opt.ExpireCallback(key, item.data)
-		delete(c.items, key)
+		c.remove(key, item)
 	}
 }
 
@@ -132,6 +176,9 @@ func NewCache(option CacheOption) *Cache {
 		shutdownSignal: shutdownChan,
 		isShutDown:     false,
 	}
+	if option.MaxSize > 0 {
+		cache.order = list.New()
+	}
 	go cache.eventLoop()
 	return cache
 }